@@ -15,11 +15,10 @@
 package spotify
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -50,6 +49,21 @@ type SimpleAlbum struct {
 	Images []Image `json:"images"`
 	// Known external URLs for this album.
 	ExternalURLs ExternalURL `json:"external_urls"`
+	// The date the album was first released.  For example, "1981-12-15".
+	// Depending on the ReleaseDatePrecision, it might be shown as
+	// "1981" or "1981-12". You can use ReleaseDateTime to convert this
+	// to a time.Time value.
+	ReleaseDate string `json:"release_date"`
+	// The precision with which ReleaseDate value is known: "year", "month", or "day"
+	ReleaseDatePrecision string `json:"release_date_precision"`
+}
+
+// ReleaseDateTime converts the album's ReleaseDate to a time.TimeValue.
+// All of the fields in the result may not be valid.  For example, if
+// s.ReleaseDatePrecision is "month", then only the month and year
+// (but not the day) of the result are valid.
+func (s *SimpleAlbum) ReleaseDateTime() time.Time {
+	return releaseDateTime(s.ReleaseDate, s.ReleaseDatePrecision)
 }
 
 // Copyright contains the copyright statement associated with an album.
@@ -74,6 +88,9 @@ type FullAlbum struct {
 	// Depending on the ReleaseDatePrecision, it might be shown as
 	// "1981" or "1981-12". You can use ReleaseDateTime to convert this
 	// to a time.Time value.
+	//
+	// These fields shadow the ones in the embedded SimpleAlbum.  Albums
+	// returned by this package have both set to the same values.
 	ReleaseDate string `json:"release_date"`
 	// The precision with which ReleaseDate value is known: "year", "month", or "day"
 	ReleaseDatePrecision string          `json:"release_date_precision"`
@@ -86,39 +103,92 @@ type FullAlbum struct {
 // f.ReleaseDatePrecision is "month", then only the month and year
 // (but not the day) of the result are valid.
 func (f *FullAlbum) ReleaseDateTime() time.Time {
-	if f.ReleaseDatePrecision == "day" {
-		result, _ := time.Parse(DateLayout, f.ReleaseDate)
+	return releaseDateTime(f.ReleaseDate, f.ReleaseDatePrecision)
+}
+
+// copyReleaseDate copies the release date that was decoded into f's own
+// fields to the embedded SimpleAlbum, so that both agree.
+func (f *FullAlbum) copyReleaseDate() {
+	f.SimpleAlbum.ReleaseDate = f.ReleaseDate
+	f.SimpleAlbum.ReleaseDatePrecision = f.ReleaseDatePrecision
+}
+
+func releaseDateTime(date, precision string) time.Time {
+	if precision == "day" {
+		result, _ := time.Parse(DateLayout, date)
 		return result
 	}
-	if f.ReleaseDatePrecision == "month" {
-		ym := strings.Split("-", f.ReleaseDate)
+	if precision == "month" {
+		ym := strings.Split(date, "-")
 		year, _ := strconv.Atoi(ym[0])
-		month, _ := strconv.Atoi(ym[1])
+		month := 1
+		if len(ym) > 1 {
+			month, _ = strconv.Atoi(ym[1])
+		}
 		return time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
 	}
-	year, _ := strconv.Atoi(f.ReleaseDate)
+	year, _ := strconv.Atoi(date)
 	return time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
 }
 
 // GetAlbum gets Spotify catalog information for a single album, given its Spotify ID.
 func (c *Client) GetAlbum(id ID) (*FullAlbum, error) {
-	spotifyURL := fmt.Sprintf("%salbums/%s", baseAddress, id)
-	resp, err := c.http.Get(string(spotifyURL))
+	spotifyURL := fmt.Sprintf("%salbums/%s", c.baseURL(), id)
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var a FullAlbum
-	err = json.NewDecoder(resp.Body).Decode(&a)
+	err = c.decode(resp.Body, &a)
 	if err != nil {
 		return nil, err
 	}
+	a.copyReleaseDate()
 	return &a, nil
 }
 
+// GetAlbumComplete is a wrapper around DefaultClient.GetAlbumComplete.
+func GetAlbumComplete(id ID) (*FullAlbum, error) {
+	return DefaultClient.GetAlbumComplete(id)
+}
+
+// GetAlbumComplete is like GetAlbum, but it also fetches the album's
+// remaining tracks.  GetAlbum only includes the first 50 tracks of an album;
+// GetAlbumComplete follows the paging links until Tracks contains all of
+// them, and leaves Tracks.Next empty.
+func (c *Client) GetAlbumComplete(id ID) (*FullAlbum, error) {
+	a, err := c.GetAlbum(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.fetchRemainingTracks(a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// AlbumMarkets is a wrapper around DefaultClient.AlbumMarkets.
+func AlbumMarkets(id ID) ([]string, error) {
+	return DefaultClient.AlbumMarkets(id)
+}
+
+// AlbumMarkets returns the markets in which an album is available, as ISO
+// 3166-1 alpha-2 country codes.  An album counts as available in a market
+// when at least one of its tracks is.  The list can contain more than 180
+// markets.  Like TrackMarkets, it is only returned when the album is
+// requested without a market.
+func (c *Client) AlbumMarkets(id ID) ([]string, error) {
+	album, err := c.GetAlbum(id)
+	if err != nil {
+		return nil, err
+	}
+	return album.AvailableMarkets, nil
+}
+
 func toStringSlice(ids []ID) []string {
 	result := make([]string, len(ids))
 	for i, str := range ids {
@@ -135,30 +205,55 @@ func GetAlbums(ids ...ID) ([]*FullAlbum, error) {
 // GetAlbums gets Spotify Catalog information for multiple albums, given their
 // Spotify IDs.  It supports up to 20 IDs in a single call.  Albums are returned
 // in the order requested.  If an album is not found, that position in the
-// result slice will be nil.
+// result slice will be nil.  More than 20 IDs results in a TooManyIDsError,
+// and no IDs results in an empty slice without a request being made.
 func (c *Client) GetAlbums(ids ...ID) ([]*FullAlbum, error) {
-	if len(ids) > 20 {
-		return nil, errors.New("spotify: exceeded maximum number of albums")
+	if err := checkIDs("GetAlbums", 20, ids); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*FullAlbum{}, nil
 	}
-	spotifyURL := fmt.Sprintf("%salbums?ids=%s", baseAddress, strings.Join(toStringSlice(ids), ","))
-	resp, err := c.http.Get(spotifyURL)
+	spotifyURL := fmt.Sprintf("%salbums?ids=%s", c.baseURL(), strings.Join(toStringSlice(ids), ","))
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var a struct {
 		Albums []*FullAlbum `json:"albums"`
 	}
-	err = json.NewDecoder(resp.Body).Decode(&a)
+	err = c.decode(resp.Body, &a)
 	if err != nil {
 		return nil, err
 	}
+	for _, album := range a.Albums {
+		if album != nil {
+			album.copyReleaseDate()
+		}
+	}
 	return a.Albums, nil
 }
 
+// fetchRemainingTracks follows the paging links in a.Tracks until all of
+// the album's tracks have been fetched.
+func (c *Client) fetchRemainingTracks(a *FullAlbum) error {
+	next := a.Tracks.Next
+	for next != "" {
+		var page SimpleTrackPage
+		if err := c.getPage(next, &page); err != nil {
+			return err
+		}
+		a.Tracks.Tracks = append(a.Tracks.Tracks, page.Tracks...)
+		next = page.Next
+	}
+	a.Tracks.Next = ""
+	return nil
+}
+
 // AlbumType represents the type of an album. It can be used to filter
 // results when searching for albums.
 type AlbumType int
@@ -169,10 +264,15 @@ type AlbumType int
 const (
 	AlbumTypeAlbum       AlbumType = 1 << iota
 	AlbumTypeSingle                = 1 << iota
-	AlbummTypeAppearsOn            = 1 << iota
+	AlbumTypeAppearsOn             = 1 << iota
 	AlbumTypeCompilation           = 1 << iota
 )
 
+// AlbummTypeAppearsOn is the original, misspelled name of AlbumTypeAppearsOn.
+//
+// Deprecated: use AlbumTypeAppearsOn.
+const AlbummTypeAppearsOn = AlbumTypeAppearsOn
+
 func (at AlbumType) encode() string {
 	types := []string{}
 	if at&AlbumTypeAlbum != 0 {
@@ -181,7 +281,7 @@ func (at AlbumType) encode() string {
 	if at&AlbumTypeSingle != 0 {
 		types = append(types, "single")
 	}
-	if at&AlbummTypeAppearsOn != 0 {
+	if at&AlbumTypeAppearsOn != 0 {
 		types = append(types, "appears_on")
 	}
 	if at&AlbumTypeCompilation != 0 {
@@ -199,10 +299,12 @@ func GetAlbumTracks(id ID) (*SimpleTrackPage, error) {
 // If you only care about the tracks, this call is more efficient
 // than GetAlbum.
 func (c *Client) GetAlbumTracks(id ID) (*SimpleTrackPage, error) {
-	return c.GetAlbumTracksOpt(id, -1, -1)
+	return c.GetAlbumTracksWithOptions(id, nil)
 }
 
 // GetAlbumTracksOpt is a wrapper around DefaultClient.GetAlbumTracksOpt.
+//
+// Deprecated: use GetAlbumTracksWithOptions.
 func GetAlbumTracksOpt(id ID, limit, offset int) (*SimpleTrackPage, error) {
 	return DefaultClient.GetAlbumTracksOpt(id, limit, offset)
 }
@@ -212,29 +314,112 @@ func GetAlbumTracksOpt(id ID, limit, offset int) (*SimpleTrackPage, error) {
 // The maximum number of results to return is specified by limit.
 // The offset argument can be used to specify the index of the first track to return.
 // It can be used along with limit to reqeust the next set of results.
+// Pass -1 for either argument to leave it unset.
+//
+// Deprecated: use GetAlbumTracksWithOptions, which also supports a market.
 func (c *Client) GetAlbumTracksOpt(id ID, limit, offset int) (*SimpleTrackPage, error) {
-	spotifyURL := fmt.Sprintf("%salbums/%s/tracks", baseAddress, id)
-	v := url.Values{}
+	var opt Options
 	if limit != -1 {
-		v.Set("limit", strconv.Itoa(limit))
+		opt.Limit = &limit
 	}
 	if offset != -1 {
-		v.Set("offset", strconv.Itoa(offset))
+		opt.Offset = &offset
 	}
-	optional := v.Encode()
-	if optional != "" {
-		spotifyURL = spotifyURL + "?" + optional
+	return c.GetAlbumTracksWithOptions(id, &opt)
+}
+
+// GetAlbumTracksWithOptions is a wrapper around
+// DefaultClient.GetAlbumTracksWithOptions.
+func GetAlbumTracksWithOptions(id ID, opt *Options) (*SimpleTrackPage, error) {
+	return DefaultClient.GetAlbumTracksWithOptions(id, opt)
+}
+
+// GetAlbumTracksWithOptions behaves like GetAlbumTracks, with the exception that it
+// allows you to specify extra parameters that limit the number of results returned.
+// The maximum number of results to return is specified by the Limit option (up
+// to 50).  The Offset option can be used to specify the index of the first track
+// to return.  It can be used along with Limit to request the next set of results.
+//
+// If the Country option is specified, it is used as the market for Track
+// Relinking: tracks that aren't available in that market are replaced with
+// an equivalent track that is, where possible.
+func (c *Client) GetAlbumTracksWithOptions(id ID, opt *Options) (*SimpleTrackPage, error) {
+	spotifyURL := fmt.Sprintf("%salbums/%s/tracks", c.baseURL(), id)
+	if opt != nil {
+		v := url.Values{}
+		if opt.Country != nil {
+			v.Set("market", *opt.Country)
+		}
+		if opt.Limit != nil {
+			v.Set("limit", strconv.Itoa(*opt.Limit))
+		}
+		if opt.Offset != nil {
+			v.Set("offset", strconv.Itoa(*opt.Offset))
+		}
+		if params := v.Encode(); params != "" {
+			spotifyURL += "?" + params
+		}
 	}
-	resp, err := c.http.Get(spotifyURL)
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
-
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeError(resp)
+	}
 	var result SimpleTrackPage
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	err = c.decode(resp.Body, &result)
 	if err != nil {
 		return nil, err
 	}
 	return &result, nil
 }
+
+// GetAlbumTracksAll is a wrapper around DefaultClient.GetAlbumTracksAll.
+func GetAlbumTracksAll(id ID, opt *Options) ([]SimpleTrack, error) {
+	return DefaultClient.GetAlbumTracksAll(id, opt)
+}
+
+// GetAlbumTracksAll gets every track on an album, following the paging
+// links until all of the tracks have been retrieved.  This is useful for
+// box sets and compilations with more tracks than fit in a single page.
+// The Country option is honored as described for GetAlbumTracksWithOptions, and
+// the Limit option controls the page size.  The Offset option is ignored.
+//
+// The tracks are sorted by DiscNumber and then by TrackNumber, so the
+// result is in tracklist order even for multi-disc albums.
+func (c *Client) GetAlbumTracksAll(id ID, opt *Options) ([]SimpleTrack, error) {
+	first := Options{}
+	if opt != nil {
+		first.Country = opt.Country
+		first.Limit = opt.Limit
+	}
+	if first.Limit == nil {
+		limit := 50
+		first.Limit = &limit
+	}
+	page, err := c.GetAlbumTracksWithOptions(id, &first)
+	if err != nil {
+		return nil, err
+	}
+	tracks := make([]SimpleTrack, 0, page.Total)
+	for {
+		tracks = append(tracks, page.Tracks...)
+		if page.Next == "" {
+			break
+		}
+		next := page.Next
+		page = &SimpleTrackPage{}
+		if err := c.getPage(next, page); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(tracks, func(i, j int) bool {
+		if tracks[i].DiscNumber != tracks[j].DiscNumber {
+			return tracks[i].DiscNumber < tracks[j].DiscNumber
+		}
+		return tracks[i].TrackNumber < tracks[j].TrackNumber
+	})
+	return tracks, nil
+}
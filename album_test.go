@@ -17,6 +17,7 @@ package spotify
 import (
 	"net/http"
 	"testing"
+	"time"
 )
 
 // The example from https://developer.spotify.com/web-api/get-album/
@@ -38,6 +39,17 @@ func TestFindAlbum(t *testing.T) {
 	if released.Year() != 1983 {
 		t.Errorf("Expected release date 1983, got %d\n", released.Year())
 	}
+	if album.SimpleAlbum.ReleaseDate != album.ReleaseDate {
+		t.Errorf("Expected the embedded SimpleAlbum to have release date %q, got %q",
+			album.ReleaseDate, album.SimpleAlbum.ReleaseDate)
+	}
+}
+
+func TestFullAlbumReleaseDateLiteral(t *testing.T) {
+	a := FullAlbum{ReleaseDate: "1981-12", ReleaseDatePrecision: "month"}
+	if got := a.ReleaseDateTime(); !got.Equal(time.Date(1981, 12, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected release date %v", got)
+	}
 }
 
 func TestFindAlbumBadID(t *testing.T) {
@@ -111,3 +123,123 @@ func TestFindAlbumTracks(t *testing.T) {
 		t.Error("Expected 1 track, got", len(res.Tracks))
 	}
 }
+
+func TestGetAlbumComplete(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"id": "abc",
+			"tracks": {
+				"items": [ { "name": "One" }, { "name": "Two" } ],
+				"limit": 2, "offset": 0, "total": 3,
+				"next": "https://api.spotify.com/v1/albums/abc/tracks?offset=2&limit=2"
+			}
+		}`},
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"items": [ { "name": "Three" } ],
+			"limit": 2, "offset": 2, "total": 3, "next": null
+		}`},
+	)
+	album, err := client.GetAlbumComplete("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := len(album.Tracks.Tracks); l != 3 {
+		t.Fatalf("Wanted 3 tracks, got %d", l)
+	}
+	if album.Tracks.Tracks[2].Name != "Three" || album.Tracks.Next != "" {
+		t.Errorf("Unexpected tracks page %+v", album.Tracks)
+	}
+	if l := len(rt.requests); l != 2 {
+		t.Errorf("Wanted 2 requests, got %d", l)
+	}
+}
+
+func TestGetAlbumTracksAll(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"items": [ { "name": "One", "track_number": 1 }, { "name": "Two", "track_number": 2 } ],
+			"limit": 2, "offset": 0, "total": 3,
+			"next": "https://api.spotify.com/v1/albums/abc/tracks?offset=2&limit=2&market=SE"
+		}`},
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"items": [ { "name": "Three", "track_number": 3 } ],
+			"limit": 2, "offset": 2, "total": 3, "next": null
+		}`},
+	)
+	market, limit := "SE", 2
+	tracks, err := client.GetAlbumTracksAll("abc", &Options{Country: &market, Limit: &limit})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if l := len(tracks); l != 3 {
+		t.Errorf("Wanted 3 tracks, got %d\n", l)
+		return
+	}
+	if tracks[2].Name != "Three" {
+		t.Errorf("Wanted track 'Three', got '%s'\n", tracks[2].Name)
+	}
+	if l := len(rt.requests); l != 2 {
+		t.Errorf("Wanted 2 requests, got %d\n", l)
+		return
+	}
+	if m := rt.requests[0].URL.Query().Get("market"); m != "SE" {
+		t.Errorf("Wanted market SE, got '%s'\n", m)
+	}
+}
+
+func TestGetAlbumTracksAllOrder(t *testing.T) {
+	client := testClientString(http.StatusOK, `{
+		"items": [
+			{ "name": "2-1", "disc_number": 2, "track_number": 1 },
+			{ "name": "1-2", "disc_number": 1, "track_number": 2 },
+			{ "name": "1-1", "disc_number": 1, "track_number": 1 }
+		]
+	}`)
+	tracks, err := client.GetAlbumTracksAll("abc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"1-1", "1-2", "2-1"} {
+		if tracks[i].Name != name {
+			t.Errorf("Wanted track %s at position %d, got %s", name, i, tracks[i].Name)
+		}
+	}
+}
+
+func TestReleaseDateTimePrecision(t *testing.T) {
+	tests := []struct {
+		date, precision string
+		want            time.Time
+	}{
+		{"1981-12-15", "day", time.Date(1981, 12, 15, 0, 0, 0, 0, time.UTC)},
+		{"1981-12", "month", time.Date(1981, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{"1981", "year", time.Date(1981, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		a := SimpleAlbum{ReleaseDate: tt.date, ReleaseDatePrecision: tt.precision}
+		if got := a.ReleaseDateTime(); !got.Equal(tt.want) {
+			t.Errorf("%s (%s): got %v, want %v", tt.date, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestAlbumMarkets(t *testing.T) {
+	client := testClientString(http.StatusOK, `{ "id": "abc", "available_markets": [ "SE", "US" ] }`)
+	markets, err := client.AlbumMarkets("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(markets) != 2 || markets[0] != "SE" || markets[1] != "US" {
+		t.Errorf("Expected [SE US], got %v", markets)
+	}
+}
+
+func TestAlbumTypeAppearsOn(t *testing.T) {
+	if s := AlbumType(AlbumTypeAppearsOn).encode(); s != "appears_on" {
+		t.Errorf("Expected appears_on, got %q", s)
+	}
+	if AlbummTypeAppearsOn != AlbumTypeAppearsOn {
+		t.Error("The deprecated name should keep working")
+	}
+}
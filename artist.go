@@ -15,12 +15,16 @@
 package spotify
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // SimpleArtist contains basic info about an artist.
@@ -42,12 +46,36 @@ type FullArtist struct {
 	Popularity int `json:"popularity"`
 	// A list of genres the artist is associated with.  For example, "Prog Rock"
 	// or "Post-Grunge".  If not yet classified, the slice is empty.
-	Genres    []string `json:"genres"`
-	Followers Followers
+	Genres []string `json:"genres"`
+	// Information about the followers of the artist.
+	Followers Followers `json:"followers"`
 	// Images of the artist in various sizes, widest first.
 	Images []Image `json:"images"`
 }
 
+// PrimaryGenre returns the first genre the artist is associated with, or
+// the empty string if the artist hasn't been classified.
+func (a *FullArtist) PrimaryGenre() string {
+	if len(a.Genres) == 0 {
+		return ""
+	}
+	return a.Genres[0]
+}
+
+// NormalizeGenre converts a genre to a canonical form so that variants of
+// the same genre can be grouped together.  The result is lowercase, with
+// hyphens and underscores replaced by spaces and runs of spaces collapsed.
+// For example, "Hip-Hop" and "hip  hop" both become "hip hop".
+func NormalizeGenre(genre string) string {
+	genre = strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' {
+			return ' '
+		}
+		return r
+	}, strings.ToLower(genre))
+	return strings.Join(strings.Fields(genre), " ")
+}
+
 // GetArtist is a wrapper around DefaultClient.GetArtist.
 func GetArtist(id ID) (*FullArtist, error) {
 	return DefaultClient.GetArtist(id)
@@ -55,17 +83,17 @@ func GetArtist(id ID) (*FullArtist, error) {
 
 // GetArtist gets Spotify catalog information for a single artist, given its Spotify ID.
 func (c *Client) GetArtist(id ID) (*FullArtist, error) {
-	spotifyURL := fmt.Sprintf("%sartists/%s", baseAddress, id)
-	resp, err := c.http.Get(spotifyURL)
+	spotifyURL := fmt.Sprintf("%sartists/%s", c.baseURL(), id)
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var a FullArtist
-	err = json.NewDecoder(resp.Body).Decode(&a)
+	err = c.decode(resp.Body, &a)
 	if err != nil {
 		return nil, err
 	}
@@ -81,27 +109,67 @@ func GetArtists(ids ...ID) ([]*FullArtist, error) {
 // Spotify IDs.  It supports up to 50 artists in a single call.  Artists are
 // returned in the order requested.  If an artist is not found, that position
 // in the result will be nil.  Duplicate IDs will result in duplicate artists
-// in the result.
+// in the result.  More than 50 IDs results in a TooManyIDsError, and no IDs
+// results in an empty slice without a request being made.
 func (c *Client) GetArtists(ids ...ID) ([]*FullArtist, error) {
-	spotifyURL := fmt.Sprintf("%sartists?ids=%s", baseAddress, strings.Join(toStringSlice(ids), ","))
-	resp, err := c.http.Get(spotifyURL)
+	if err := checkIDs("GetArtists", 50, ids); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*FullArtist{}, nil
+	}
+	spotifyURL := fmt.Sprintf("%sartists?ids=%s", c.baseURL(), strings.Join(toStringSlice(ids), ","))
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var a struct {
 		Artists []*FullArtist
 	}
-	err = json.NewDecoder(resp.Body).Decode(&a)
+	err = c.decode(resp.Body, &a)
 	if err != nil {
 		return nil, err
 	}
 	return a.Artists, nil
 }
 
+// GetArtistsSortedByFollowers is a wrapper around
+// DefaultClient.GetArtistsSortedByFollowers.
+func GetArtistsSortedByFollowers(ids ...ID) ([]FullArtist, error) {
+	return DefaultClient.GetArtistsSortedByFollowers(ids...)
+}
+
+// GetArtistsSortedByFollowers gets Spotify catalog information for several
+// artists and returns them sorted by follower count, most followed first.
+// Any number of IDs can be specified; they are fetched 50 at a time.
+// Artists that aren't found are omitted from the result.
+func (c *Client) GetArtistsSortedByFollowers(ids ...ID) ([]FullArtist, error) {
+	result := make([]FullArtist, 0, len(ids))
+	for start := 0; start < len(ids); start += 50 {
+		end := start + 50
+		if end > len(ids) {
+			end = len(ids)
+		}
+		artists, err := c.GetArtists(ids[start:end]...)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range artists {
+			if a != nil {
+				result = append(result, *a)
+			}
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Followers.Count > result[j].Followers.Count
+	})
+	return result, nil
+}
+
 // GetArtistsTopTracks is a wrapper around DefaultClient.GetArtistsTopTracks.
 func GetArtistsTopTracks(artistID ID, country string) ([]FullTrack, error) {
 	return DefaultClient.GetArtistsTopTracks(artistID, country)
@@ -111,26 +179,71 @@ func GetArtistsTopTracks(artistID ID, country string) ([]FullTrack, error) {
 // tracks in a particular country.  It returns a maximum of 10 tracks.  The
 // country is specified as an ISO 3166-1 alpha-2 country code.
 func (c *Client) GetArtistsTopTracks(artistID ID, country string) ([]FullTrack, error) {
-	spotifyURL := fmt.Sprintf("%sartists/%s/top-tracks?country=%s", baseAddress, artistID, country)
-	resp, err := c.http.Get(spotifyURL)
+	spotifyURL := fmt.Sprintf("%sartists/%s/top-tracks?country=%s", c.baseURL(), artistID, country)
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var t struct {
 		Tracks []FullTrack `json:"tracks"`
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&t)
+	err = c.decode(resp.Body, &t)
 	if err != nil {
 		return nil, err
 	}
 	return t.Tracks, nil
 }
 
+// GetArtistsTopTracksMulti is a wrapper around DefaultClient.GetArtistsTopTracksMulti.
+func GetArtistsTopTracksMulti(artistID ID, markets ...string) (map[string][]FullTrack, error) {
+	return DefaultClient.GetArtistsTopTracksMulti(artistID, markets...)
+}
+
+// GetArtistsTopTracksMulti gets an artist's top tracks in several countries
+// at once.  Up to four requests are made concurrently (fewer if a lower
+// limit was set with SetMaxConcurrency).  The result is keyed by country code and only
+// includes the countries that have top tracks for the artist.  If any of
+// the requests fail, the first error (in the order the markets were given)
+// is returned.
+func (c *Client) GetArtistsTopTracksMulti(artistID ID, markets ...string) (map[string][]FullTrack, error) {
+	type result struct {
+		tracks []FullTrack
+		err    error
+	}
+	var (
+		results = make([]result, len(markets))
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, containsConcurrency)
+	)
+	for i, market := range markets {
+		wg.Add(1)
+		go func(i int, market string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			tracks, err := c.GetArtistsTopTracks(artistID, market)
+			results[i] = result{tracks, err}
+		}(i, market)
+	}
+	wg.Wait()
+
+	topTracks := make(map[string][]FullTrack)
+	for i, r := range results {
+		if r.err != nil {
+			return nil, r.err
+		}
+		if len(r.tracks) > 0 {
+			topTracks[markets[i]] = r.tracks
+		}
+	}
+	return topTracks, nil
+}
+
 // GetRelatedArtists is a wrapper around DefaultClient.GetRelatedArtists.
 func GetRelatedArtists(id ID) ([]FullArtist, error) {
 	return DefaultClient.GetRelatedArtists(id)
@@ -140,26 +253,123 @@ func GetRelatedArtists(id ID) ([]FullArtist, error) {
 // given artist.  Similarity is based on analysis of the Spotify community's
 // listening history.  This function returns up to 20 artists that are considered
 // related to the specified artist.
+//
+// Spotify has deprecated this endpoint.  Applications that don't have
+// access to it get a DeprecatedEndpointError.
 func (c *Client) GetRelatedArtists(id ID) ([]FullArtist, error) {
-	spotifyURL := fmt.Sprintf("%sartists/%s/related-artists", baseAddress, id)
-	resp, err := c.http.Get(spotifyURL)
+	return c.getRelatedArtists(context.Background(), id)
+}
+
+func (c *Client) getRelatedArtists(ctx context.Context, id ID) ([]FullArtist, error) {
+	spotifyURL := fmt.Sprintf("%sartists/%s/related-artists", c.baseURL(), id)
+	req, err := http.NewRequest("GET", spotifyURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, deprecated("GetRelatedArtists", decodeError(resp))
 	}
 	var a struct {
 		Artists []FullArtist `json:"artists"`
 	}
-	err = json.NewDecoder(resp.Body).Decode(&a)
+	err = c.decode(resp.Body, &a)
 	if err != nil {
 		return nil, err
 	}
 	return a.Artists, nil
 }
 
+// maxRelatedArtistsGraphNodes is the largest number of artists that
+// RelatedArtistsGraph will discover before it stops expanding the graph.
+const maxRelatedArtistsGraphNodes = 1000
+
+// RelatedArtistsGraph is a wrapper around DefaultClient.RelatedArtistsGraph.
+func RelatedArtistsGraph(ctx context.Context, rootID ID, depth int) (map[ID][]ID, error) {
+	return DefaultClient.RelatedArtistsGraph(ctx, rootID, depth)
+}
+
+// RelatedArtistsGraph explores the related artists of rootID breadth first,
+// up to depth hops away.  The result maps each artist that was expanded to
+// the IDs of its related artists, in the order Spotify returned them.
+// Artists found on the last hop appear only as related artists; they aren't
+// expanded themselves.  Each artist is expanded at most once, even if it is
+// related to several others.
+//
+// The related artists of each hop are fetched concurrently.  To keep the
+// number of requests bounded, no new artists are added to the graph after
+// 1000 of them have been discovered.  If a request fails or ctx is
+// cancelled, the traversal stops and the error is returned.
+//
+// See GetRelatedArtists for a caveat about the endpoint being deprecated.
+func (c *Client) RelatedArtistsGraph(ctx context.Context, rootID ID, depth int) (map[ID][]ID, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	graph := make(map[ID][]ID)
+	seen := map[ID]bool{rootID: true}
+	level := []ID{rootID}
+	for hop := 0; hop < depth && len(level) > 0; hop++ {
+		var (
+			related  = make([][]ID, len(level))
+			wg       sync.WaitGroup
+			sem      = make(chan struct{}, containsConcurrency)
+			mu       sync.Mutex
+			firstErr error
+		)
+		for i, id := range level {
+			wg.Add(1)
+			go func(i int, id ID) {
+				defer wg.Done()
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				if ctx.Err() != nil {
+					return
+				}
+				artists, err := c.getRelatedArtists(ctx, id)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mu.Unlock()
+					return
+				}
+				ids := make([]ID, len(artists))
+				for j, a := range artists {
+					ids[j] = a.ID
+				}
+				related[i] = ids
+			}(i, id)
+		}
+		wg.Wait()
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var next []ID
+		for i, id := range level {
+			graph[id] = related[i]
+			for _, r := range related[i] {
+				if !seen[r] && len(seen) < maxRelatedArtistsGraphNodes {
+					seen[r] = true
+					next = append(next, r)
+				}
+			}
+		}
+		level = next
+	}
+	return graph, nil
+}
+
 // GetArtistAlbums is a wrapper around DefaultClient.GetArtistAlbums.
 func GetArtistAlbums(artistID ID) (*SimpleAlbumPage, error) {
 	return DefaultClient.GetArtistAlbums(artistID)
@@ -182,7 +392,7 @@ func GetArtistAlbumsOpt(artistID ID, options *Options, t *AlbumType) (*SimpleAlb
 // The AlbumType argument can be used to find a particular type of album.  Search
 // for multiple types by OR-ing the types together.
 func (c *Client) GetArtistAlbumsOpt(artistID ID, options *Options, t *AlbumType) (*SimpleAlbumPage, error) {
-	spotifyURL := fmt.Sprintf("%sartists/%s/albums", baseAddress, artistID)
+	spotifyURL := fmt.Sprintf("%sartists/%s/albums", c.baseURL(), artistID)
 	// add optional query string if options were specified
 	values := url.Values{}
 	if t != nil {
@@ -208,19 +418,142 @@ func (c *Client) GetArtistAlbumsOpt(artistID ID, options *Options, t *AlbumType)
 	if query := values.Encode(); query != "" {
 		spotifyURL += "?" + query
 	}
-	resp, err := c.http.Get(spotifyURL)
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var p SimpleAlbumPage
-	err = json.NewDecoder(resp.Body).Decode(&p)
+	err = c.decode(resp.Body, &p)
 	if err != nil {
 		return nil, err
 	}
 	return &p, nil
 }
+
+// ErrNoReleases is returned by LatestRelease for artists without any
+// releases of their own.
+var ErrNoReleases = errors.New("spotify: artist has no releases")
+
+// LatestRelease is a wrapper around DefaultClient.LatestRelease.
+func LatestRelease(artistID ID, opt *Options) (*SimpleAlbum, error) {
+	return DefaultClient.LatestRelease(artistID, opt)
+}
+
+// LatestRelease gets the artist's most recently released album, single, or
+// compilation.  Releases that the artist only appears on aren't considered.
+// Release dates are compared using SimpleAlbum.ReleaseDateTime, so a release
+// known only by its year counts as released on January 1.  If several
+// releases share the newest date, the first one listed by the Web API is
+// returned.  If the artist has no releases, ErrNoReleases is returned.
+//
+// Only the Country field of opt is used.  As with GetArtistAlbumsOpt,
+// the US market is used if no country is specified.
+func (c *Client) LatestRelease(artistID ID, opt *Options) (*SimpleAlbum, error) {
+	limit := 50
+	listOpt := Options{Limit: &limit}
+	if opt != nil {
+		listOpt.Country = opt.Country
+	}
+	types := AlbumTypeAlbum | AlbumTypeSingle | AlbumTypeCompilation
+	page, err := c.GetArtistAlbumsOpt(artistID, &listOpt, &types)
+	if err != nil {
+		return nil, err
+	}
+	var latest *SimpleAlbum
+	var latestDate time.Time
+	for {
+		for i := range page.Albums {
+			a := &page.Albums[i]
+			if d := a.ReleaseDateTime(); latest == nil || d.After(latestDate) {
+				latest, latestDate = a, d
+			}
+		}
+		if page.Next == "" {
+			break
+		}
+		next := page.Next
+		page = &SimpleAlbumPage{}
+		if err := c.getPage(next, page); err != nil {
+			return nil, err
+		}
+	}
+	if latest == nil {
+		return nil, ErrNoReleases
+	}
+	return latest, nil
+}
+
+// GetArtistDiscography is a wrapper around DefaultClient.GetArtistDiscography.
+func GetArtistDiscography(artistID ID, opt *Options) ([]FullAlbum, error) {
+	return DefaultClient.GetArtistDiscography(artistID, opt)
+}
+
+// GetArtistDiscography gets every album, single, compilation and
+// appears-on release for the artist, with full album data and all of
+// each album's tracks.  Albums are returned in the order the Web API
+// lists them, without duplicates.
+//
+// Only the Country field of opt is used.  As with GetArtistAlbumsOpt,
+// the US market is used if no country is specified.
+//
+// This is an expensive call: it makes one request per 50 releases to
+// list them, one per 20 albums to fetch them, and one more for every
+// 50 tracks beyond the first 50 on an album.
+func (c *Client) GetArtistDiscography(artistID ID, opt *Options) ([]FullAlbum, error) {
+	limit := 50
+	listOpt := Options{Limit: &limit}
+	if opt != nil {
+		listOpt.Country = opt.Country
+	}
+	types := AlbumTypeAlbum | AlbumTypeSingle | AlbumTypeAppearsOn | AlbumTypeCompilation
+	page, err := c.GetArtistAlbumsOpt(artistID, &listOpt, &types)
+	if err != nil {
+		return nil, err
+	}
+	var ids []ID
+	seen := make(map[ID]bool)
+	for {
+		for _, a := range page.Albums {
+			if !seen[a.ID] {
+				seen[a.ID] = true
+				ids = append(ids, a.ID)
+			}
+		}
+		if page.Next == "" {
+			break
+		}
+		next := page.Next
+		page = &SimpleAlbumPage{}
+		if err := c.getPage(next, page); err != nil {
+			return nil, err
+		}
+	}
+
+	albums := make([]FullAlbum, 0, len(ids))
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > 20 {
+			n = 20
+		}
+		batch, err := c.GetAlbums(ids[:n]...)
+		if err != nil {
+			return nil, err
+		}
+		ids = ids[n:]
+		for _, a := range batch {
+			if a == nil {
+				continue
+			}
+			if err := c.fetchRemainingTracks(a); err != nil {
+				return nil, err
+			}
+			albums = append(albums, *a)
+		}
+	}
+	return albums, nil
+}
@@ -15,7 +15,13 @@
 package spotify
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -162,3 +168,269 @@ func TestArtistAlbumsFiltered(t *testing.T) {
 		t.Error("Expected 'The Days / Nights', got ", albums.Albums[0].Name)
 	}
 }
+
+func TestRelatedArtistsDeprecated(t *testing.T) {
+	client := testClientString(http.StatusForbidden, `{ "error": { "status": 403, "message": "Forbidden." } }`)
+	_, err := client.GetRelatedArtists(ID("43ZHCT0cAZBISjO8DG9PnE"))
+	de, ok := err.(DeprecatedEndpointError)
+	if !ok {
+		t.Error("Expected DeprecatedEndpointError, got", err)
+		return
+	}
+	if de.Method != "GetRelatedArtists" || de.Err.Status != http.StatusForbidden {
+		t.Errorf("Unexpected error contents: %+v\n", de)
+	}
+	var e Error
+	if !errors.As(err, &e) || e.Status != http.StatusForbidden {
+		t.Error("Expected the DeprecatedEndpointError to wrap the Web API error, got", err)
+	}
+}
+
+func TestRelatedArtistsNotFound(t *testing.T) {
+	client := testClientString(http.StatusNotFound, `{ "error": { "status": 404, "message": "Not found." } }`)
+	_, err := client.GetRelatedArtists(ID("mistyped"))
+	if e, ok := err.(Error); !ok || e.Status != http.StatusNotFound {
+		t.Error("Expected a 404 Error, got", err)
+	}
+}
+
+func TestGetArtistsSortedByFollowers(t *testing.T) {
+	client := testClientString(http.StatusOK, `{ "artists": [
+		{ "id": "a", "name": "Small", "followers": { "total": 10 } },
+		null,
+		{ "id": "b", "name": "Big", "followers": { "total": 5000 } },
+		{ "id": "c", "name": "Medium", "followers": { "total": 300 } }
+	] }`)
+	artists, err := client.GetArtistsSortedByFollowers("a", "missing", "b", "c")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	expected := []string{"Big", "Medium", "Small"}
+	if len(artists) != len(expected) {
+		t.Errorf("Wanted %d artists, got %d\n", len(expected), len(artists))
+		return
+	}
+	for i, name := range expected {
+		if artists[i].Name != name {
+			t.Errorf("Wanted %s at position %d, got %s\n", name, i, artists[i].Name)
+		}
+	}
+}
+
+func TestGetArtistDiscography(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"items": [ { "id": "a1" }, { "id": "a2" } ],
+			"next": "https://api.spotify.com/v1/artists/x/albums?offset=2&limit=2"
+		}`},
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"items": [ { "id": "a2" }, { "id": "a3" } ]
+		}`},
+		cannedResponse{statusCode: http.StatusOK, body: `{ "albums": [
+			{ "id": "a1", "tracks": { "items": [ { "id": "t1" } ], "next": "https://api.spotify.com/v1/albums/a1/tracks?offset=1" } },
+			{ "id": "a2", "tracks": { "items": [ { "id": "t3" } ] } },
+			null
+		] }`},
+		cannedResponse{statusCode: http.StatusOK, body: `{ "items": [ { "id": "t2" } ] }`},
+	)
+	albums, err := client.GetArtistDiscography("x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(albums) != 2 || albums[0].ID != "a1" || albums[1].ID != "a2" {
+		t.Fatalf("Unexpected albums: %+v", albums)
+	}
+	if tracks := albums[0].Tracks.Tracks; len(tracks) != 2 || tracks[1].ID != "t2" {
+		t.Errorf("Expected remaining tracks to be fetched, got %+v", tracks)
+	}
+	q := rt.requests[0].URL.Query()
+	if q.Get("album_type") != "album,single,appears_on,compilation" || q.Get("limit") != "50" {
+		t.Errorf("Unexpected album listing query: %s", rt.requests[0].URL.RawQuery)
+	}
+	if ids := rt.requests[2].URL.Query().Get("ids"); ids != "a1,a2,a3" {
+		t.Errorf("Expected albums to be deduplicated, requested %s", ids)
+	}
+}
+
+// marketRoundTripper answers top track requests with a track for each
+// market listed in tracks, and with an empty list for other markets.
+type marketRoundTripper struct {
+	tracks map[string]string
+}
+
+func (m marketRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	market := req.URL.Query().Get("country")
+	body := `{ "tracks": [] }`
+	if name, ok := m.tracks[market]; ok {
+		body = `{ "tracks": [ { "name": "` + name + `" } ] }`
+	}
+	if market == "XX" {
+		return &http.Response{
+			StatusCode: http.StatusBadRequest,
+			Body:       ioutil.NopCloser(strings.NewReader(`{ "error": { "status": 400, "message": "invalid market" } }`)),
+		}, nil
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func TestGetArtistsTopTracksMulti(t *testing.T) {
+	client := &Client{http: &http.Client{Transport: marketRoundTripper{
+		tracks: map[string]string{"US": "Hit", "SE": "Hitt"},
+	}}}
+	tracks, err := client.GetArtistsTopTracksMulti("x", "US", "JP", "SE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 2 {
+		t.Fatalf("Expected 2 markets, got %d", len(tracks))
+	}
+	if tracks["US"][0].Name != "Hit" || tracks["SE"][0].Name != "Hitt" {
+		t.Errorf("Unexpected result: %+v", tracks)
+	}
+	if _, ok := tracks["JP"]; ok {
+		t.Error("Expected markets without top tracks to be omitted")
+	}
+
+	_, err = client.GetArtistsTopTracksMulti("x", "US", "XX")
+	if e, ok := err.(Error); !ok || e.Status != http.StatusBadRequest {
+		t.Errorf("Expected a 400 error, got %v", err)
+	}
+}
+
+func TestGetArtistsTopTracksMultiConcurrency(t *testing.T) {
+	rt := &concurrencyRoundTripper{}
+	client := &Client{http: &http.Client{Transport: rt}}
+	markets := make([]string, 20)
+	for i := range markets {
+		markets[i] = fmt.Sprintf("M%d", i)
+	}
+	if _, err := client.GetArtistsTopTracksMulti("x", markets...); err != nil {
+		t.Fatal(err)
+	}
+	if rt.max > containsConcurrency {
+		t.Errorf("Expected at most %d requests in flight, got %d", containsConcurrency, rt.max)
+	}
+}
+
+func TestGenres(t *testing.T) {
+	a := FullArtist{Genres: []string{"Prog Rock", "Post-Grunge"}}
+	if g := a.PrimaryGenre(); g != "Prog Rock" {
+		t.Errorf("Expected Prog Rock, got %s", g)
+	}
+	if g := (&FullArtist{}).PrimaryGenre(); g != "" {
+		t.Errorf("Expected no genre, got %s", g)
+	}
+	for _, in := range []string{"Hip-Hop", "hip hop", " HIP_hop ", "hip -  hop"} {
+		if g := NormalizeGenre(in); g != "hip hop" {
+			t.Errorf("NormalizeGenre(%q) = %q, want \"hip hop\"", in, g)
+		}
+	}
+}
+
+func TestLatestRelease(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"items": [
+				{ "id": "old", "release_date": "2015-06-01", "release_date_precision": "day" },
+				{ "id": "new", "release_date": "2017-03", "release_date_precision": "month" }
+			],
+			"next": "https://api.spotify.com/v1/artists/x/albums?offset=2"
+		}`},
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"items": [ { "id": "year", "release_date": "2017", "release_date_precision": "year" } ]
+		}`},
+	)
+	album, err := client.LatestRelease("x", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if album.ID != "new" {
+		t.Errorf("Expected the newest release, got %s", album.ID)
+	}
+	if q := rt.requests[0].URL.Query().Get("album_type"); q != "album,single,compilation" {
+		t.Errorf("Unexpected album types: %s", q)
+	}
+
+	client = testClientString(http.StatusOK, `{ "items": [] }`)
+	if _, err := client.LatestRelease("x", nil); err != ErrNoReleases {
+		t.Errorf("Expected ErrNoReleases, got %v", err)
+	}
+}
+
+type relatedRoundTripper struct {
+	related map[string][]string
+
+	mu       sync.Mutex
+	expanded map[string]int
+}
+
+func (r *relatedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/v1/artists/"), "/related-artists")
+	r.mu.Lock()
+	r.expanded[id]++
+	r.mu.Unlock()
+	if id == "broken" {
+		return &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Body:       ioutil.NopCloser(strings.NewReader(`{ "error": { "status": 500, "message": "oops" } }`)),
+		}, nil
+	}
+	var artists []string
+	for _, a := range r.related[id] {
+		artists = append(artists, fmt.Sprintf(`{ "id": %q }`, a))
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(`{ "artists": [` + strings.Join(artists, ",") + `] }`)),
+	}, nil
+}
+
+func TestRelatedArtistsGraph(t *testing.T) {
+	rt := &relatedRoundTripper{
+		related: map[string][]string{
+			"root": {"a", "b"},
+			"a":    {"root", "b", "c"},
+			"b":    {"a", "d"},
+			"c":    {"e"},
+		},
+		expanded: make(map[string]int),
+	}
+	client := &Client{http: &http.Client{Transport: rt}}
+	graph, err := client.RelatedArtistsGraph(context.Background(), "root", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph) != 3 {
+		t.Errorf("Expected 3 expanded artists, got %d: %v", len(graph), graph)
+	}
+	if got := graph["a"]; len(got) != 3 || got[2] != "c" {
+		t.Errorf("Unexpected related artists for a: %v", got)
+	}
+	if _, ok := graph["c"]; ok {
+		t.Error("Artists on the last hop shouldn't be expanded")
+	}
+	for id, n := range rt.expanded {
+		if n != 1 {
+			t.Errorf("Artist %s was expanded %d times", id, n)
+		}
+	}
+}
+
+func TestRelatedArtistsGraphError(t *testing.T) {
+	rt := &relatedRoundTripper{
+		related:  map[string][]string{"root": {"a", "broken"}},
+		expanded: make(map[string]int),
+	}
+	client := &Client{http: &http.Client{Transport: rt}}
+	_, err := client.RelatedArtistsGraph(context.Background(), "root", 3)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if e, ok := err.(Error); !ok || e.Status != http.StatusInternalServerError {
+		t.Errorf("Expected a 500 Error, got %v", err)
+	}
+}
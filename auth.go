@@ -15,9 +15,14 @@
 package spotify
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"golang.org/x/oauth2"
 )
@@ -64,8 +69,94 @@ const (
 	ScopeUserReadEmail = "user-read-email"
 	// ScopeUserReadBirthdate seeks read access to a user's birthdate.
 	ScopeUserReadBirthdate = "user-read-birthdate"
+	// ScopeUserReadRecentlyPlayed seeks read access to a user's
+	// recently played tracks.
+	ScopeUserReadRecentlyPlayed = "user-read-recently-played"
+	// ScopeUserReadPlaybackState seeks read access to a user's
+	// player state, such as the active device and what's playing.
+	ScopeUserReadPlaybackState = "user-read-playback-state"
+	// ScopeUserModifyPlaybackState seeks permission to control
+	// playback on a user's devices.
+	ScopeUserModifyPlaybackState = "user-modify-playback-state"
+	// ScopeUserReadCurrentlyPlaying seeks read access to a user's
+	// currently playing content.
+	ScopeUserReadCurrentlyPlaying = "user-read-currently-playing"
+	// ScopeUserTopRead seeks read access to a user's top artists and tracks.
+	ScopeUserTopRead = "user-top-read"
+	// ScopeUserReadPlaybackPosition seeks read access to a user's
+	// playback position in episodes.
+	ScopeUserReadPlaybackPosition = "user-read-playback-position"
+	// ScopeStreaming seeks permission to play content in the Web
+	// Playback SDK and other Spotify clients.
+	ScopeStreaming = "streaming"
+	// ScopeUGCImageUpload seeks permission to upload images, such as
+	// custom playlist cover art.
+	ScopeUGCImageUpload = "ugc-image-upload"
 )
 
+// knownScopes contains all of the scope constants above.
+var knownScopes = map[string]bool{
+	ScopePlaylistReadPrivate:       true,
+	ScopePlaylistModifyPublic:      true,
+	ScopePlaylistModifyPrivate:     true,
+	ScopePlaylistReadCollaborative: true,
+	ScopeUserFollowModify:          true,
+	ScopeUserFollowRead:            true,
+	ScopeUserLibraryModify:         true,
+	ScopeUserLibraryRead:           true,
+	ScopeUserReadPrivate:           true,
+	ScopeUserReadEmail:             true,
+	ScopeUserReadBirthdate:         true,
+	ScopeUserReadRecentlyPlayed:    true,
+	ScopeUserReadPlaybackState:     true,
+	ScopeUserModifyPlaybackState:   true,
+	ScopeUserReadCurrentlyPlaying:  true,
+	ScopeUserTopRead:               true,
+	ScopeUserReadPlaybackPosition:  true,
+	ScopeStreaming:                 true,
+	ScopeUGCImageUpload:            true,
+}
+
+// requiredScopes returns the scopes that a request to the Web API endpoint
+// at path (for example "/v1/me/tracks") needs, or nil if it isn't known.
+// When several scopes are returned, any one of them is sufficient.
+func requiredScopes(method, path string) []string {
+	if i := strings.Index(path, "/v1/"); i >= 0 {
+		path = path[i+len("/v1/"):]
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	read := method == "GET"
+	switch {
+	case len(parts) == 1 && parts[0] == "me":
+		return []string{ScopeUserReadPrivate}
+	case parts[0] == "me" && (parts[1] == "tracks" || parts[1] == "albums"):
+		if read {
+			return []string{ScopeUserLibraryRead}
+		}
+		return []string{ScopeUserLibraryModify}
+	case parts[0] == "me" && parts[1] == "following":
+		if read {
+			return []string{ScopeUserFollowRead}
+		}
+		return []string{ScopeUserFollowModify}
+	case parts[0] == "me" && parts[1] == "playlists":
+		return []string{ScopePlaylistReadPrivate}
+	case parts[0] == "users" && len(parts) >= 3 && parts[2] == "playlists":
+		if read {
+			return []string{ScopePlaylistReadPrivate}
+		}
+		return []string{ScopePlaylistModifyPublic, ScopePlaylistModifyPrivate}
+	}
+	return nil
+}
+
+// ValidScope reports whether scope is one of the scopes defined by this
+// package.  Spotify silently ignores scopes it doesn't recognize, so you
+// can use ValidScope to catch typos before sending users to authorize.
+func ValidScope(scope string) bool {
+	return knownScopes[scope]
+}
+
 // Authenticator provides convenience functions for implementing the OAuth2 flow.
 // You should always use `NewAuthenticator` to make them.
 //
@@ -114,6 +205,24 @@ func (a *Authenticator) SetAuthInfo(clientID, secretKey string) {
 	a.config.ClientSecret = secretKey
 }
 
+// SetEndpoint overwrites the URLs of the OAuth2 authorization and token
+// endpoints used by the authenticator, which default to AuthURL and TokenURL.
+// This can be used to point the authenticator at a mock OAuth2 server for
+// testing, or to route the requests through a proxy.
+func (a *Authenticator) SetEndpoint(authURL, tokenURL string) {
+	a.config.Endpoint = oauth2.Endpoint{
+		AuthURL:  authURL,
+		TokenURL: tokenURL,
+	}
+}
+
+// Scopes returns the scopes that the authenticator requests authorization for.
+func (a Authenticator) Scopes() []string {
+	scopes := make([]string, len(a.config.Scopes))
+	copy(scopes, a.config.Scopes)
+	return scopes
+}
+
 // AuthURL returns a URL to the the Spotify Accounts Service's OAuth2 endpoint.
 //
 // State is a token to protect the user from CSRF attacks.  You should pass the
@@ -123,34 +232,194 @@ func (a Authenticator) AuthURL(state string) string {
 	return a.config.AuthCodeURL(state)
 }
 
+// AuthURLWithDialog is like AuthURL, but it forces the user to approve the
+// application again, even if they've done so before.  Spotify otherwise skips
+// the dialog for returning users, which prevents someone who is already
+// logged in from switching to a different Spotify account.
+func (a Authenticator) AuthURLWithDialog(state string) string {
+	return a.config.AuthCodeURL(state, oauth2.SetAuthURLParam("show_dialog", "true"))
+}
+
 // Token pulls an authorization code from an HTTP request and attempts to exchange
 // it for an access token.  The standard use case is to call Token from the handler
 // that handles requests to your application's redirect URL.
 func (a Authenticator) Token(state string, r *http.Request) (*oauth2.Token, error) {
+	return a.TokenContext(oauth2.NoContext, state, r)
+}
+
+// TokenContext is like Token, but the token exchange is made using the
+// specified context.  The context controls the lifetime of the exchange
+// request, so it can be used to honor the deadline of an incoming request.
+func (a Authenticator) TokenContext(ctx context.Context, state string, r *http.Request) (*oauth2.Token, error) {
+	code, err := codeFromRedirect(state, r)
+	if err != nil {
+		return nil, err
+	}
+	return a.config.Exchange(ctx, code)
+}
+
+// codeFromRedirect validates the state of the redirect request r and
+// returns its authorization code.
+func codeFromRedirect(state string, r *http.Request) (string, error) {
 	values := r.URL.Query()
 	if e := values.Get("error"); e != "" {
-		return nil, errors.New("spotify: auth failed - " + e)
+		return "", errors.New("spotify: auth failed - " + e)
 	}
 	code := values.Get("code")
 	if code == "" {
-		return nil, errors.New("spotify: didn't get access code")
+		return "", errors.New("spotify: didn't get access code")
 	}
 	actualState := values.Get("state")
 	if actualState != state {
-		return nil, errors.New("spotify: redirect state parameter doesn't match")
+		return "", errors.New("spotify: redirect state parameter doesn't match")
+	}
+	return code, nil
+}
+
+// PKCESession holds the values that an application using the authorization
+// code flow with PKCE (Proof Key for Code Exchange) must keep between
+// sending the user to AuthURLWithPKCE and handling the redirect in
+// TokenFromSession.  Store it with the user's session, for example in a
+// cookie-backed session store; the Verifier must not be exposed to anyone
+// else.
+type PKCESession struct {
+	// State protects the user from CSRF attacks, like the state
+	// passed to AuthURL.
+	State string
+	// Verifier is the secret that proves the token request comes
+	// from the application that started the authorization.
+	Verifier string
+	// Challenge is the S256 hash of Verifier that is sent to Spotify
+	// with the authorization request.
+	Challenge string
+}
+
+// NewPKCESession generates a new PKCESession with a random state and
+// code verifier.
+func NewPKCESession() (*PKCESession, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
 	}
-	return a.config.Exchange(oauth2.NoContext, code)
+	verifier := oauth2.GenerateVerifier()
+	return &PKCESession{
+		State:     base64.RawURLEncoding.EncodeToString(b),
+		Verifier:  verifier,
+		Challenge: oauth2.S256ChallengeFromVerifier(verifier),
+	}, nil
+}
+
+// AuthURLWithPKCE is like AuthURL, but it uses the state of sess and sends
+// its code challenge, so that the token can only be obtained with the
+// session's verifier.  This is the flow to use in applications that can't
+// keep a client secret, such as mobile and single-page applications.
+func (a Authenticator) AuthURLWithPKCE(sess *PKCESession) string {
+	return a.config.AuthCodeURL(sess.State, oauth2.S256ChallengeOption(sess.Verifier))
+}
+
+// TokenFromSession is like Token, but it completes an authorization started
+// with AuthURLWithPKCE: it validates the redirect against the state of sess
+// and exchanges the code using the session's verifier.
+func (a Authenticator) TokenFromSession(sess *PKCESession, r *http.Request) (*oauth2.Token, error) {
+	return a.TokenFromSessionContext(context.Background(), sess, r)
+}
+
+// TokenFromSessionContext is like TokenFromSession, but the token exchange
+// is made using the specified context.
+func (a Authenticator) TokenFromSessionContext(ctx context.Context, sess *PKCESession, r *http.Request) (*oauth2.Token, error) {
+	code, err := codeFromRedirect(sess.State, r)
+	if err != nil {
+		return nil, err
+	}
+	return a.config.Exchange(ctx, code, oauth2.VerifierOption(sess.Verifier))
 }
 
 // Exchange is like Token, except it allows you to manually specify the access
 // code instead of pulling it out of an HTTP request.
 func (a Authenticator) Exchange(code string) (*oauth2.Token, error) {
-	return a.config.Exchange(oauth2.NoContext, code)
+	return a.ExchangeContext(oauth2.NoContext, code)
+}
+
+// ExchangeContext is like Exchange, but the token exchange is made using
+// the specified context.
+func (a Authenticator) ExchangeContext(ctx context.Context, code string) (*oauth2.Token, error) {
+	return a.config.Exchange(ctx, code)
 }
 
 // NewClient creates a Client that will use the specified access token for its API requests.
 func (a Authenticator) NewClient(token *oauth2.Token) Client {
 	return Client{
-		http: a.config.Client(oauth2.NoContext, token),
+		http:    a.config.Client(oauth2.NoContext, token),
+		country: new(countryCache),
+	}
+}
+
+// unauthenticatedClient returns an HTTP client that sends requests like
+// c does, but without adding c's access token.  It is used for requests to
+// hosts other than the Web API.
+func (c *Client) unauthenticatedClient() *http.Client {
+	client := c.httpClient()
+	transport, ok := client.Transport.(*oauth2.Transport)
+	if !ok {
+		return client
 	}
+	return &http.Client{Transport: transport.Base, Timeout: client.Timeout}
+}
+
+// Token returns the OAuth2 token used by the client.  If the token has
+// expired and a refresh token is available, it is refreshed first.
+// Token returns an error if the client doesn't use OAuth2 (for example,
+// DefaultClient) or if the token can't be refreshed.
+func (c *Client) Token() (*oauth2.Token, error) {
+	transport, ok := c.httpClient().Transport.(*oauth2.Transport)
+	if !ok || transport.Source == nil {
+		return nil, errors.New("spotify: client isn't using an OAuth2 token")
+	}
+	return transport.Source.Token()
+}
+
+// StreamingToken returns the client's current access token, refreshing it
+// first if needed, for handing to the Web Playback SDK in a browser.  The
+// token must have been authorized with the ScopeStreaming scope.  If the
+// token response listed the granted scopes and ScopeStreaming isn't among
+// them, StreamingToken returns an error instead.
+//
+// The access token gives full access to the user's account within its
+// scopes, so only send it to the user it belongs to.
+func (c *Client) StreamingToken() (string, error) {
+	t, err := c.Token()
+	if err != nil {
+		return "", err
+	}
+	if granted, ok := t.Extra("scope").(string); ok {
+		found := false
+		for _, scope := range strings.Fields(granted) {
+			if scope == ScopeStreaming {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", errors.New("spotify: token wasn't authorized with the streaming scope")
+		}
+	}
+	return t.AccessToken, nil
+}
+
+// TokenExpiry returns the time at which the client's access token expires.
+// The zero time is returned if the client doesn't have a valid token, or if
+// the token doesn't expire.
+func (c *Client) TokenExpiry() time.Time {
+	t, err := c.Token()
+	if err != nil {
+		return time.Time{}
+	}
+	return t.Expiry
+}
+
+// Valid reports whether the client has an access token that hasn't expired
+// (possibly after refreshing it).
+func (c *Client) Valid() bool {
+	t, err := c.Token()
+	return err == nil && t.Valid()
 }
@@ -0,0 +1,233 @@
+// Copyright 2014, 2015 Zac Bergquist
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spotify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestSetEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/token" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{ "access_token": "mock-token", "token_type": "Bearer", "expires_in": 3600 }`)
+	}))
+	defer server.Close()
+
+	auth := NewAuthenticator("http://localhost/callback", ScopeUserReadPrivate)
+	auth.SetAuthInfo("id", "secret")
+	auth.SetEndpoint(server.URL+"/authorize", server.URL+"/token")
+
+	if u := auth.AuthURL("state"); !strings.HasPrefix(u, server.URL+"/authorize?") {
+		t.Error("AuthURL didn't use the custom endpoint:", u)
+	}
+	token, err := auth.Exchange("code")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if token.AccessToken != "mock-token" {
+		t.Errorf("Wanted token 'mock-token', got '%s'\n", token.AccessToken)
+	}
+}
+
+func TestPKCESession(t *testing.T) {
+	sess, err := NewPKCESession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := r.FormValue("code_verifier"); v != sess.Verifier {
+			t.Errorf("Expected code_verifier %q, got %q", sess.Verifier, v)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{ "access_token": "mock-token", "token_type": "Bearer", "expires_in": 3600 }`)
+	}))
+	defer server.Close()
+
+	auth := NewAuthenticator("http://localhost/callback")
+	auth.SetAuthInfo("id", "")
+	auth.SetEndpoint(server.URL+"/authorize", server.URL+"/token")
+
+	u := auth.AuthURLWithPKCE(sess)
+	for _, param := range []string{"state=" + sess.State, "code_challenge=" + sess.Challenge, "code_challenge_method=S256"} {
+		if !strings.Contains(u, param) {
+			t.Errorf("Expected %s in %s", param, u)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/callback?code=abc&state=wrong", nil)
+	if _, err := auth.TokenFromSession(sess, r); err == nil {
+		t.Error("Expected an error for a mismatched state")
+	}
+	r = httptest.NewRequest("GET", "/callback?code=abc&state="+sess.State, nil)
+	token, err := auth.TokenFromSession(sess, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "mock-token" {
+		t.Errorf("Wanted token 'mock-token', got '%s'", token.AccessToken)
+	}
+}
+
+func TestTokenContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("The token request shouldn't be sent with a canceled context")
+	}))
+	defer server.Close()
+
+	auth := NewAuthenticator("http://localhost/callback")
+	auth.SetEndpoint(server.URL+"/authorize", server.URL+"/token")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest("GET", "/callback?code=abc&state=xyz", nil)
+	if _, err := auth.TokenContext(ctx, "xyz", r); err == nil {
+		t.Error("Expected an error for a canceled context")
+	}
+}
+
+func TestTokenFromSessionContextCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("The token request shouldn't be sent with a canceled context")
+	}))
+	defer server.Close()
+
+	auth := NewAuthenticator("http://localhost/callback")
+	auth.SetEndpoint(server.URL+"/authorize", server.URL+"/token")
+	sess, err := NewPKCESession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest("GET", "/callback?code=abc&state="+sess.State, nil)
+	if _, err := auth.TokenFromSessionContext(ctx, sess, r); err == nil {
+		t.Error("Expected an error for a canceled context")
+	}
+}
+
+func TestScopes(t *testing.T) {
+	auth := NewAuthenticator("http://localhost/callback", ScopeUserReadPrivate, "user-libary-read")
+	scopes := auth.Scopes()
+	if len(scopes) != 2 || scopes[0] != ScopeUserReadPrivate {
+		t.Error("Unexpected scopes:", scopes)
+		return
+	}
+	if !ValidScope(scopes[0]) {
+		t.Error("Expected", scopes[0], "to be valid")
+	}
+	if ValidScope(scopes[1]) {
+		t.Error("Expected", scopes[1], "to be invalid")
+	}
+	for _, scope := range []string{ScopeUserReadRecentlyPlayed, ScopeUserTopRead, ScopeStreaming, ScopeUGCImageUpload} {
+		if !ValidScope(scope) {
+			t.Error("Expected", scope, "to be valid")
+		}
+	}
+}
+
+func TestAuthURLWithDialog(t *testing.T) {
+	auth := NewAuthenticator("http://localhost/callback", ScopeUserReadPrivate)
+	if u := auth.AuthURL("state"); strings.Contains(u, "show_dialog") {
+		t.Error("AuthURL shouldn't force the dialog:", u)
+	}
+	if u := auth.AuthURLWithDialog("state"); !strings.Contains(u, "show_dialog=true") {
+		t.Error("Expected show_dialog=true in", u)
+	}
+}
+
+func TestClientTokenExpiry(t *testing.T) {
+	auth := NewAuthenticator("http://localhost/callback")
+	expiry := time.Now().Add(time.Hour).Round(time.Second)
+	client := auth.NewClient(&oauth2.Token{
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		Expiry:       expiry,
+	})
+	if !client.Valid() {
+		t.Error("Expected a valid client")
+	}
+	if e := client.TokenExpiry(); !e.Equal(expiry) {
+		t.Errorf("Wanted expiry %v, got %v\n", expiry, e)
+	}
+	token, err := client.Token()
+	if err != nil || token.RefreshToken != "refresh" {
+		t.Error("Expected the refresh token to be available, got", token, err)
+	}
+
+	var unauthenticated Client
+	if unauthenticated.Valid() {
+		t.Error("A client without a token shouldn't be valid")
+	}
+	if e := unauthenticated.TokenExpiry(); !e.IsZero() {
+		t.Error("Expected zero expiry, got", e)
+	}
+}
+
+func TestRequiredScopes(t *testing.T) {
+	tests := []struct {
+		method, path string
+		want         string
+	}{
+		{"GET", "/v1/me", ScopeUserReadPrivate},
+		{"GET", "/v1/me/tracks/contains", ScopeUserLibraryRead},
+		{"PUT", "/v1/me/tracks", ScopeUserLibraryModify},
+		{"GET", "/v1/me/following", ScopeUserFollowRead},
+		{"DELETE", "/v1/me/following", ScopeUserFollowModify},
+		{"GET", "/v1/me/playlists", ScopePlaylistReadPrivate},
+		{"POST", "/v1/users/bob/playlists/abc/tracks", ScopePlaylistModifyPublic + " " + ScopePlaylistModifyPrivate},
+		{"GET", "/v1/tracks/abc", ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(requiredScopes(tt.method, tt.path), " "); got != tt.want {
+			t.Errorf("requiredScopes(%s, %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestStreamingToken(t *testing.T) {
+	auth := NewAuthenticator("http://localhost/callback", ScopeStreaming)
+	token := &oauth2.Token{AccessToken: "access", Expiry: time.Now().Add(time.Hour)}
+
+	client := auth.NewClient(token.WithExtra(map[string]interface{}{"scope": "user-read-email streaming"}))
+	if s, err := client.StreamingToken(); err != nil || s != "access" {
+		t.Errorf("Expected the access token, got %q %v", s, err)
+	}
+	client = auth.NewClient(token)
+	if s, err := client.StreamingToken(); err != nil || s != "access" {
+		t.Errorf("Expected the access token when scopes are unknown, got %q %v", s, err)
+	}
+	client = auth.NewClient(token.WithExtra(map[string]interface{}{"scope": "user-read-email"}))
+	if _, err := client.StreamingToken(); err == nil {
+		t.Error("Expected an error for a token without the streaming scope")
+	}
+	var unauthenticated Client
+	if _, err := unauthenticated.StreamingToken(); err == nil {
+		t.Error("Expected an error for a client without a token")
+	}
+}
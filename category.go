@@ -15,11 +15,13 @@
 package spotify
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
 )
 
 // Category is used by Spotify to tag items in.  For example, on the Spotify
@@ -32,22 +34,68 @@ type Category struct {
 	// The Spotify category ID.  This isn't a base-62 Spotify ID, its just
 	// a short string that describes and identifies the category (ie "party").
 	ID string `json:"id"`
-	// The name of the category
+	// The name of the category, in the language requested with the locale
+	// argument of GetCategoryOpt or GetCategoriesOpt.
 	Name string `json:"name"`
 }
 
+// Icon returns the category's largest icon, or nil if it has none.  Spotify
+// doesn't always report the size of category icons; if none of them have a
+// known size, the first icon is returned.
+func (c *Category) Icon() *Image {
+	var icon *Image
+	for i := range c.Icons {
+		if icon == nil || c.Icons[i].Width > icon.Width {
+			icon = &c.Icons[i]
+		}
+	}
+	return icon
+}
+
+// ErrInvalidLocale is returned when a locale isn't of the form
+// language_COUNTRY, for example "es_MX".
+var ErrInvalidLocale = errors.New("spotify: locale must be a language code and country code joined by an underscore, such as es_MX")
+
+// validLocale reports whether locale has the shape of a Spotify locale:
+// a lowercase ISO 639 language code and an uppercase ISO 3166-1 alpha-2
+// country code, joined by an underscore.  It doesn't check that the
+// codes actually exist.
+func validLocale(locale string) bool {
+	i := strings.IndexByte(locale, '_')
+	if i < 2 || i > 3 || len(locale)-i-1 != 2 {
+		return false
+	}
+	for j, r := range locale {
+		switch {
+		case j < i:
+			if r < 'a' || r > 'z' {
+				return false
+			}
+		case j > i:
+			if r < 'A' || r > 'Z' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // GetCategoryOpt is like GetCategory, but it accepts optional arguments.
 // The country parameter is an ISO 3166-1 alpha-2 country code.  It can be
 // used to ensure that the category exists for a particular country.  The
 // locale argument is an ISO 639 language code and an ISO 3166-1 alpha-2
 // country code, separated by an underscore.  It can be used to get the
 // category strings in a particular language (for example: "es_MX" means
-// get categories in Mexico, returned in Spanish).
+// get categories in Mexico, returned in Spanish).  A malformed locale
+// results in ErrInvalidLocale.
 //
 // This call requries authorization.
 func (c *Client) GetCategoryOpt(id, country, locale string) (Category, error) {
 	cat := Category{}
-	spotifyURL := fmt.Sprintf("%sbrowse/categories/%s", baseAddress, id)
+	if locale != "" && !validLocale(locale) {
+		return cat, ErrInvalidLocale
+	}
+	spotifyURL := fmt.Sprintf("%sbrowse/categories/%s", c.baseURL(), id)
 	values := url.Values{}
 	if country != "" {
 		values.Set("country", country)
@@ -58,15 +106,15 @@ func (c *Client) GetCategoryOpt(id, country, locale string) (Category, error) {
 	if query := values.Encode(); query != "" {
 		spotifyURL += "?" + query
 	}
-	resp, err := c.http.Get(spotifyURL)
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return cat, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return cat, decodeError(resp.Body)
+		return cat, decodeError(resp)
 	}
-	err = json.NewDecoder(resp.Body).Decode(&cat)
+	err = c.decode(resp.Body, &cat)
 	return cat, err
 }
 
@@ -85,8 +133,11 @@ func (c *Client) GetCategoryPlaylists(catID string) (*SimplePlaylistPage, error)
 
 // GetCategoryPlaylistsOpt is like GetCategoryPlaylists, but it accepts optional
 // arguments.  This call requires authorization.
+//
+// Spotify has deprecated this endpoint.  Applications that don't have
+// access to it get a DeprecatedEndpointError.
 func (c *Client) GetCategoryPlaylistsOpt(catID string, opt *Options) (*SimplePlaylistPage, error) {
-	spotifyURL := fmt.Sprintf("%sbrowse/categories/%s/playlists", baseAddress, catID)
+	spotifyURL := fmt.Sprintf("%sbrowse/categories/%s/playlists", c.baseURL(), catID)
 	if opt != nil {
 		values := url.Values{}
 		if opt.Country != nil {
@@ -102,18 +153,18 @@ func (c *Client) GetCategoryPlaylistsOpt(catID string, opt *Options) (*SimplePla
 			spotifyURL += "?" + query
 		}
 	}
-	resp, err := c.http.Get(spotifyURL)
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, deprecated("GetCategoryPlaylists", decodeError(resp))
 	}
 	wrapper := struct {
 		Playlists SimplePlaylistPage `json:"playlists"`
 	}{}
-	err = json.NewDecoder(resp.Body).Decode(&wrapper)
+	err = c.decode(resp.Body, &wrapper)
 	if err != nil {
 		return nil, err
 	}
@@ -133,9 +184,13 @@ func (c *Client) GetCategories() (*CategoryPage, error) {
 // The locale option can be used to get the results in a particular language.
 // It consists of an ISO 639 language code and an ISO 3166-1 alpha-2 country
 // code, separated by an underscore.  Specify the empty string to have results
-// returned in the Spotify default language (American English).
+// returned in the Spotify default language (American English).  A malformed
+// locale results in ErrInvalidLocale.
 func (c *Client) GetCategoriesOpt(opt *Options, locale string) (*CategoryPage, error) {
-	spotifyURL := baseAddress + "browse/categories"
+	if locale != "" && !validLocale(locale) {
+		return nil, ErrInvalidLocale
+	}
+	spotifyURL := c.baseURL() + "browse/categories"
 	values := url.Values{}
 	if locale != "" {
 		values.Set("locale", locale)
@@ -154,20 +209,100 @@ func (c *Client) GetCategoriesOpt(opt *Options, locale string) (*CategoryPage, e
 	if query := values.Encode(); query != "" {
 		spotifyURL += "?" + query
 	}
-	resp, err := c.http.Get(spotifyURL)
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	wrapper := struct {
 		Categories CategoryPage `json:"categories"`
 	}{}
-	err = json.NewDecoder(resp.Body).Decode(&wrapper)
+	err = c.decode(resp.Body, &wrapper)
 	if err != nil {
 		return nil, err
 	}
 	return &wrapper.Categories, nil
 }
+
+// DiscoverOptions contains the parameters for Discover.
+type DiscoverOptions struct {
+	// The country to tailor the results to, as an ISO 3166-1 alpha-2
+	// country code.
+	Country *string
+	// The language to return featured playlist messages in, such as
+	// "es_MX".  A malformed locale results in ErrInvalidLocale.
+	Locale *string
+	// The maximum number of items to return in each list.
+	Limit *int
+	// The IDs of the categories to include playlists for.
+	Categories []string
+}
+
+// DiscoverResult contains the lists returned by Discover.
+type DiscoverResult struct {
+	NewReleases *SimpleAlbumPage
+	// The message Spotify shows above the featured playlists,
+	// for example "Good morning".
+	FeaturedMessage   string
+	FeaturedPlaylists *SimplePlaylistPage
+	// The playlists of each requested category, keyed by category ID.
+	CategoryPlaylists map[string]*SimplePlaylistPage
+}
+
+// Discover fetches what a "browse" screen typically shows - new releases,
+// featured playlists, and the playlists of the requested categories - in
+// one call.  The requests are sent concurrently.  If any of them fails,
+// the first error (new releases first, then featured playlists, then the
+// categories in the order given) is returned.  This call requires
+// authorization.
+//
+// Like FeaturedPlaylists and GetCategoryPlaylists, Discover relies on
+// endpoints that Spotify has deprecated.
+func (c *Client) Discover(opt *DiscoverOptions) (*DiscoverResult, error) {
+	var common Options
+	featured := &PlaylistOptions{}
+	var categories []string
+	if opt != nil {
+		common.Country = opt.Country
+		common.Limit = opt.Limit
+		featured.Locale = opt.Locale
+		categories = opt.Categories
+	}
+	featured.Options = common
+
+	var (
+		result      = &DiscoverResult{CategoryPlaylists: make(map[string]*SimplePlaylistPage)}
+		categoryRes = make([]*SimplePlaylistPage, len(categories))
+		errs        = make([]error, 2+len(categories))
+		wg          sync.WaitGroup
+	)
+	wg.Add(2 + len(categories))
+	go func() {
+		defer wg.Done()
+		result.NewReleases, errs[0] = c.NewReleasesOpt(&common)
+	}()
+	go func() {
+		defer wg.Done()
+		result.FeaturedMessage, result.FeaturedPlaylists, errs[1] = c.FeaturedPlaylistsOpt(featured)
+	}()
+	for i, id := range categories {
+		go func(i int, id string) {
+			defer wg.Done()
+			categoryRes[i], errs[2+i] = c.GetCategoryPlaylistsOpt(id, &common)
+		}(i, id)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, id := range categories {
+		result.CategoryPlaylists[id] = categoryRes[i]
+	}
+	return result, nil
+}
@@ -15,7 +15,11 @@
 package spotify
 
 import (
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -115,6 +119,49 @@ func TestGetCategoriesInvalidToken(t *testing.T) {
 	}
 }
 
+func TestCategoryIcon(t *testing.T) {
+	c := Category{Icons: []Image{{Width: 64, URL: "small"}, {Width: 274, URL: "large"}, {URL: "unknown"}}}
+	if icon := c.Icon(); icon == nil || icon.URL != "large" {
+		t.Errorf("Expected the largest icon, got %+v", icon)
+	}
+	c.Icons = []Image{{URL: "first"}, {URL: "second"}}
+	if icon := c.Icon(); icon == nil || icon.URL != "first" {
+		t.Errorf("Expected the first icon, got %+v", icon)
+	}
+	c.Icons = nil
+	if icon := c.Icon(); icon != nil {
+		t.Errorf("Expected no icon, got %+v", icon)
+	}
+}
+
+func TestInvalidLocale(t *testing.T) {
+	for _, locale := range []string{"es_MX", "fil_PH"} {
+		if !validLocale(locale) {
+			t.Errorf("Expected %q to be valid", locale)
+		}
+	}
+	for _, locale := range []string{"es", "es-MX", "ES_mx", "e_MX", "es_MEX", "es_MX_x"} {
+		if validLocale(locale) {
+			t.Errorf("Expected %q to be invalid", locale)
+		}
+	}
+
+	client := testClientString(http.StatusOK, getCategories)
+	if _, err := client.GetCategoriesOpt(nil, "es-MX"); err != ErrInvalidLocale {
+		t.Errorf("GetCategoriesOpt: expected ErrInvalidLocale, got %v", err)
+	}
+	if _, err := client.GetCategoryOpt("party", "", "spanish"); err != ErrInvalidLocale {
+		t.Errorf("GetCategoryOpt: expected ErrInvalidLocale, got %v", err)
+	}
+	locale := "es"
+	if _, _, err := client.FeaturedPlaylistsOpt(&PlaylistOptions{Locale: &locale}); err != ErrInvalidLocale {
+		t.Errorf("FeaturedPlaylistsOpt: expected ErrInvalidLocale, got %v", err)
+	}
+	if getLastRequest(client) != nil {
+		t.Error("Expected no requests to be sent for an invalid locale")
+	}
+}
+
 var getCategories = `
 {
   "categories" : {
@@ -236,3 +283,76 @@ var invalidToken = `
     "message": "Invalid access token"
   }
 }`
+
+type discoverRoundTripper struct {
+	mu      sync.Mutex
+	queries map[string]url.Values
+}
+
+func (d *discoverRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	d.mu.Lock()
+	d.queries[req.URL.Path] = req.URL.Query()
+	d.mu.Unlock()
+	var body string
+	switch req.URL.Path {
+	case "/v1/browse/new-releases":
+		body = `{ "items": [ { "id": "album" } ] }`
+	case "/v1/browse/featured-playlists":
+		body = `{ "message": "Hej", "playlists": { "items": [ { "id": "featured" } ] } }`
+	case "/v1/browse/categories/missing/playlists":
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Body:       ioutil.NopCloser(strings.NewReader(`{ "error": { "status": 404, "message": "Not found" } }`)),
+		}, nil
+	default:
+		body = `{ "playlists": { "items": [ { "id": "category" } ] } }`
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func TestDiscover(t *testing.T) {
+	rt := &discoverRoundTripper{queries: make(map[string]url.Values)}
+	client := &Client{http: &http.Client{Transport: rt}}
+	country, locale, limit := "SE", "sv_SE", 5
+	result, err := client.Discover(&DiscoverOptions{
+		Country:    &country,
+		Locale:     &locale,
+		Limit:      &limit,
+		Categories: []string{"party", "mood"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.FeaturedMessage != "Hej" || result.FeaturedPlaylists.Playlists[0].ID != "featured" {
+		t.Errorf("Unexpected featured playlists: %q %v", result.FeaturedMessage, result.FeaturedPlaylists)
+	}
+	if result.NewReleases.Albums[0].ID != "album" {
+		t.Error("Unexpected new releases", result.NewReleases)
+	}
+	if len(result.CategoryPlaylists) != 2 || result.CategoryPlaylists["mood"].Playlists[0].ID != "category" {
+		t.Error("Unexpected category playlists", result.CategoryPlaylists)
+	}
+	if len(rt.queries) != 4 {
+		t.Errorf("Expected 4 requests, got %d", len(rt.queries))
+	}
+	for path, q := range rt.queries {
+		if q.Get("country") != "SE" || q.Get("limit") != "5" {
+			t.Errorf("Expected country and limit on %s, got %v", path, q)
+		}
+	}
+	if l := rt.queries["/v1/browse/featured-playlists"].Get("locale"); l != "sv_SE" {
+		t.Errorf("Expected locale sv_SE, got %q", l)
+	}
+}
+
+func TestDiscoverError(t *testing.T) {
+	rt := &discoverRoundTripper{queries: make(map[string]url.Values)}
+	client := &Client{http: &http.Client{Transport: rt}}
+	_, err := client.Discover(&DiscoverOptions{Categories: []string{"party", "missing"}})
+	if e, ok := err.(Error); !ok || e.Status != http.StatusNotFound {
+		t.Errorf("Expected the 404 for the missing category, got %v", err)
+	}
+}
@@ -15,69 +15,269 @@
 package spotify
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
 	"net/http"
 	"strings"
+	"sync"
 )
 
 // UserHasTracks checks if one or more tracks are saved to the current user's
 // "Your Music" library.  This call requires authorization.
+//
+// The result always contains one value for each ID, in the order the IDs
+// were specified (see ErrUnexpectedResultCount).  Up to 50 IDs can be
+// checked at once; more results in a TooManyIDsError.  Use
+// UserHasTracksContext to check more.
 func (c *Client) UserHasTracks(ids ...ID) ([]bool, error) {
-	if l := len(ids); l == 0 || l > 50 {
-		return nil, errors.New("spotify: UserHasTracks supports 1 to 50 IDs per call")
+	if err := checkIDs("UserHasTracks", 50, ids); err != nil {
+		return nil, err
 	}
-	spotifyURL := fmt.Sprintf("%sme/tracks/contains?ids=%s", baseAddress, strings.Join(toStringSlice(ids), ","))
-	resp, err := c.http.Get(spotifyURL)
+	return c.userHas(context.Background(), "tracks", ids)
+}
+
+// UserHasTracksContext is like UserHasTracks, but it accepts any number of
+// IDs, and the requests are made with the given context so that a long
+// check can be canceled.  The IDs are checked in batches of 50, several
+// batches at a time.
+func (c *Client) UserHasTracksContext(ctx context.Context, ids ...ID) ([]bool, error) {
+	return c.userHas(ctx, "tracks", ids)
+}
+
+// UserHasAlbums checks if one or more albums are saved to the current user's
+// "Your Music" library.  This call requires authorization.
+//
+// The result always contains one value for each ID, in the order the IDs
+// were specified (see ErrUnexpectedResultCount).  Up to 20 IDs can be
+// checked at once; more results in a TooManyIDsError.  Use
+// UserHasAlbumsContext to check more.
+func (c *Client) UserHasAlbums(ids ...ID) ([]bool, error) {
+	if err := checkIDs("UserHasAlbums", 20, ids); err != nil {
+		return nil, err
+	}
+	return c.userHas(context.Background(), "albums", ids)
+}
+
+// UserHasAlbumsContext is like UserHasAlbums, but it accepts any number of
+// IDs, and the requests are made with the given context so that a long
+// check can be canceled.  The IDs are checked in batches of 20, several
+// batches at a time.
+func (c *Client) UserHasAlbumsContext(ctx context.Context, ids ...ID) ([]bool, error) {
+	return c.userHas(ctx, "albums", ids)
+}
+
+// containsConcurrency is the number of contains requests that calls which
+// check many items (like UserHasTracksContext) make at once.
+const containsConcurrency = 4
+
+// userHas checks which of the ids are in the current user's library of the
+// given kind ("tracks" or "albums"), in batches.  If any batch fails, the
+// remaining batches are canceled and the first error is returned.
+func (c *Client) userHas(ctx context.Context, kind string, ids []ID) ([]bool, error) {
+	batchSize := 50
+	if kind == "albums" {
+		batchSize = 20
+	}
+	result := make([]bool, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		sem      = make(chan struct{}, containsConcurrency)
+	)
+	for start := 0; start < len(ids); start += batchSize {
+		end := start + batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			err := ctx.Err()
+			if err == nil {
+				var contains []bool
+				contains, err = c.contains(ctx, kind, ids[start:end])
+				copy(result[start:end], contains)
+			}
+			if err == nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			// a count mismatch still leaves an aligned result, so
+			// only report it if nothing worse happened
+			if firstErr == nil || firstErr == ErrUnexpectedResultCount {
+				firstErr = err
+			}
+			if err != ErrUnexpectedResultCount {
+				cancel()
+			}
+		}(start, end)
+	}
+	wg.Wait()
+	if firstErr != nil && firstErr != ErrUnexpectedResultCount {
+		return nil, firstErr
+	}
+	return result, firstErr
+}
+
+// contains sends a single request to the me/{kind}/contains endpoint.
+func (c *Client) contains(ctx context.Context, kind string, ids []ID) ([]bool, error) {
+	spotifyURL := fmt.Sprintf("%sme/%s/contains?ids=%s", c.baseURL(), kind, strings.Join(toStringSlice(ids), ","))
+	req, err := http.NewRequest("GET", spotifyURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req.WithContext(ctx))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
-	var result []bool
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	return result, err
+	return c.decodeContains(resp.Body, len(ids))
 }
 
 // AddTracksToLibrary saves one or more tracks to the current user's
 // "Your Music" library.  This call requires authorization (the
 // ScopeUserLibraryModify scope).
 // A track can only be saved once; duplicate IDs are ignored.
+// Up to 50 IDs can be saved at once; more results in a TooManyIDsError.
+// Calling AddTracksToLibrary without any IDs does nothing.
 func (c *Client) AddTracksToLibrary(ids ...ID) error {
 	return c.modifyLibraryTracks(true, ids...)
 }
 
+// AddMissingTracksToLibrary saves the tracks that aren't already in the
+// current user's "Your Music" library, and returns the IDs of the tracks that
+// were saved.  It first checks which tracks are saved (see UserHasTracks), so
+// tracks that are already in the library aren't written again.  Any number of
+// IDs can be given; they are checked and saved in batches of 50.  This call
+// requires authorization (the ScopeUserLibraryRead and ScopeUserLibraryModify
+// scopes).
+func (c *Client) AddMissingTracksToLibrary(ids ...ID) ([]ID, error) {
+	var added []ID
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > 50 {
+			n = 50
+		}
+		batch := ids[:n]
+		ids = ids[n:]
+		saved, err := c.UserHasTracks(batch...)
+		if err != nil && err != ErrUnexpectedResultCount {
+			return added, err
+		}
+		var missing []ID
+		for i, id := range batch {
+			if !saved[i] {
+				missing = append(missing, id)
+			}
+		}
+		if err := c.AddTracksToLibrary(missing...); err != nil {
+			return added, err
+		}
+		added = append(added, missing...)
+	}
+	return added, nil
+}
+
 // RemoveTracksFromLibrary removes one or more tracks from the current user's
 // "Your Music" library.  This call requires authorization (the ScopeUserModifyLibrary
 // scope).  Trying to remove a track when you do not have the user's authorization
 // results in a `spotify.Error` with the status code set to http.StatusUnauthorized.
+// Up to 50 IDs can be removed at once; more results in a TooManyIDsError.
+// Calling RemoveTracksFromLibrary without any IDs does nothing.
 func (c *Client) RemoveTracksFromLibrary(ids ...ID) error {
 	return c.modifyLibraryTracks(false, ids...)
 }
 
+// BatchResult reports the outcome of an operation that was split into
+// several requests.
+type BatchResult struct {
+	// Succeeded contains the IDs from requests that succeeded.
+	Succeeded []ID
+	// Failed contains the IDs from requests that failed.  They can be
+	// passed to the same call again to retry them.
+	Failed []ID
+	// Err is the first error that occurred, or nil if every request
+	// succeeded.
+	Err error
+}
+
+// AddTracksToLibraryBatch is like AddTracksToLibrary, but it accepts any
+// number of IDs.  They are saved in batches of 50, and a failed batch
+// doesn't stop the remaining batches from being saved.  The result reports
+// which IDs were saved and which weren't.
+func (c *Client) AddTracksToLibraryBatch(ids ...ID) BatchResult {
+	return c.modifyLibraryTracksBatch(true, ids)
+}
+
+// RemoveTracksFromLibraryBatch is like RemoveTracksFromLibrary, but it
+// accepts any number of IDs.  They are removed in batches of 50, and a
+// failed batch doesn't stop the remaining batches from being removed.
+// The result reports which IDs were removed and which weren't.
+func (c *Client) RemoveTracksFromLibraryBatch(ids ...ID) BatchResult {
+	return c.modifyLibraryTracksBatch(false, ids)
+}
+
+func (c *Client) modifyLibraryTracksBatch(add bool, ids []ID) BatchResult {
+	var result BatchResult
+	for len(ids) > 0 {
+		n := len(ids)
+		if n > 50 {
+			n = 50
+		}
+		batch := ids[:n]
+		ids = ids[n:]
+		if err := c.modifyLibraryTracks(add, batch...); err != nil {
+			result.Failed = append(result.Failed, batch...)
+			if result.Err == nil {
+				result.Err = err
+			}
+			continue
+		}
+		result.Succeeded = append(result.Succeeded, batch...)
+	}
+	return result
+}
+
 func (c *Client) modifyLibraryTracks(add bool, ids ...ID) error {
-	if l := len(ids); l == 0 || l > 50 {
-		return errors.New("spotify: this call supports 1 to 50 IDs per call")
+	method := "RemoveTracksFromLibrary"
+	if add {
+		method = "AddTracksToLibrary"
+	}
+	if err := checkIDs(method, 50, ids); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
 	}
-	spotifyURL := fmt.Sprintf("%sme/tracks?ids=%s", baseAddress, strings.Join(toStringSlice(ids), ","))
-	method := "DELETE"
+	spotifyURL := fmt.Sprintf("%sme/tracks?ids=%s", c.baseURL(), strings.Join(toStringSlice(ids), ","))
+	httpMethod := "DELETE"
 	if add {
-		method = "PUT"
+		httpMethod = "PUT"
 	}
-	req, err := http.NewRequest(method, spotifyURL, nil)
+	req, err := http.NewRequest(httpMethod, spotifyURL, nil)
 	if err != nil {
 		return err
 	}
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return decodeError(resp.Body)
+		return decodeError(resp)
 	}
 	return nil
 }
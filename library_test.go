@@ -15,7 +15,14 @@
 package spotify
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -34,6 +41,17 @@ func TestUserHasTracks(t *testing.T) {
 	}
 }
 
+func TestUserHasTracksMismatchedResult(t *testing.T) {
+	client := testClientString(http.StatusOK, `[ true ]`)
+	contains, err := client.UserHasTracks("0udZHhCi7p1YzMlvI4fXoK", "55nlbqqFVnSsArIeYSQlqx")
+	if err != ErrUnexpectedResultCount {
+		t.Error("Expected ErrUnexpectedResultCount, got", err)
+	}
+	if len(contains) != 2 || !contains[0] || contains[1] {
+		t.Error("Expected [true, false], got", contains)
+	}
+}
+
 func TestAddTracksToLibrary(t *testing.T) {
 	client := testClientString(http.StatusOK, "")
 	addDummyAuth(client)
@@ -66,3 +84,146 @@ func TestRemoveTracksFromLibrary(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestLibraryIDLimits(t *testing.T) {
+	client := testClientString(http.StatusOK, `[]`)
+	ids := make([]ID, 51)
+	for i := range ids {
+		ids[i] = "4iV5W9uYEdYUVa79Axb7Rh"
+	}
+	_, err := client.UserHasTracks(ids...)
+	if e, ok := err.(TooManyIDsError); !ok || e.Method != "UserHasTracks" || e.Max != 50 || e.Count != 51 {
+		t.Errorf("Expected a TooManyIDsError, got %v", err)
+	}
+	if err := client.AddTracksToLibrary(ids...); err == nil {
+		t.Error("Expected an error for too many IDs")
+	} else if _, ok := err.(TooManyIDsError); !ok {
+		t.Errorf("Expected a TooManyIDsError, got %v", err)
+	}
+
+	contains, err := client.UserHasTracks()
+	if err != nil || len(contains) != 0 {
+		t.Errorf("Expected an empty result, got %v, %v", contains, err)
+	}
+	if err := client.RemoveTracksFromLibrary(); err != nil {
+		t.Error(err)
+	}
+	if getLastRequest(client) != nil {
+		t.Error("Expected no requests to be sent")
+	}
+}
+
+func TestAddMissingTracksToLibrary(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `[ true, false, true ]`},
+		cannedResponse{statusCode: http.StatusOK},
+	)
+	added, err := client.AddMissingTracksToLibrary("a", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 1 || added[0] != "b" {
+		t.Errorf("Expected [b] to be added, got %v", added)
+	}
+	if len(rt.requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(rt.requests))
+	}
+	if r := rt.requests[1]; r.Method != "PUT" || r.URL.Query().Get("ids") != "b" {
+		t.Errorf("Expected PUT with ids=b, got %s %s", r.Method, r.URL)
+	}
+
+	client, rt = testClientSequence(cannedResponse{statusCode: http.StatusOK, body: `[ true, true ]`})
+	added, err = client.AddMissingTracksToLibrary("a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added) != 0 || len(rt.requests) != 1 {
+		t.Errorf("Expected no tracks to be saved, got %v after %d requests", added, len(rt.requests))
+	}
+}
+
+func TestAddTracksToLibraryBatch(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK},
+		cannedResponse{statusCode: http.StatusBadGateway, body: `{ "error": { "status": 502, "message": "Bad gateway" } }`},
+		cannedResponse{statusCode: http.StatusOK},
+	)
+	ids := make([]ID, 120)
+	for i := range ids {
+		ids[i] = ID(fmt.Sprintf("track%d", i))
+	}
+	result := client.AddTracksToLibraryBatch(ids...)
+	if len(rt.requests) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(rt.requests))
+	}
+	if len(result.Succeeded) != 70 || len(result.Failed) != 50 {
+		t.Fatalf("Expected 70 saved and 50 failed, got %d and %d", len(result.Succeeded), len(result.Failed))
+	}
+	if result.Failed[0] != "track50" || result.Failed[49] != "track99" {
+		t.Errorf("Expected the second batch to fail, got %v", result.Failed)
+	}
+	if e, ok := result.Err.(Error); !ok || e.Status != http.StatusBadGateway {
+		t.Errorf("Expected a 502 error, got %v", result.Err)
+	}
+}
+
+// containsRoundTripper answers contains requests with true for every ID
+// that starts with "saved".
+type containsRoundTripper struct {
+	mu       sync.Mutex
+	requests int
+}
+
+func (c *containsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.requests++
+	c.mu.Unlock()
+	var result []bool
+	for _, id := range strings.Split(req.URL.Query().Get("ids"), ",") {
+		result = append(result, strings.HasPrefix(id, "saved"))
+	}
+	body, _ := json.Marshal(result)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(bytes.NewReader(body)),
+	}, nil
+}
+
+func TestUserHasTracksContext(t *testing.T) {
+	rt := &containsRoundTripper{}
+	client := &Client{http: &http.Client{Transport: rt}}
+	ids := make([]ID, 120)
+	for i := range ids {
+		if i%3 == 0 {
+			ids[i] = ID(fmt.Sprintf("saved%d", i))
+		} else {
+			ids[i] = ID(fmt.Sprintf("track%d", i))
+		}
+	}
+	contains, err := client.UserHasTracksContext(context.Background(), ids...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rt.requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", rt.requests)
+	}
+	for i, c := range contains {
+		if c != (i%3 == 0) {
+			t.Errorf("Wrong result for ID %d: %v", i, c)
+		}
+	}
+
+	albums, err := client.UserHasAlbumsContext(context.Background(), ids[:45]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(albums) != 45 || rt.requests != 6 {
+		t.Errorf("Expected 45 results from 3 more requests, got %d from %d", len(albums), rt.requests-3)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.UserHasTracksContext(ctx, ids...); err == nil {
+		t.Error("Expected an error for a canceled context")
+	}
+}
@@ -15,8 +15,10 @@
 package spotify
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
 )
 
 // ErrNoMorePages is the error returned when you attempt to get the next
@@ -26,10 +28,11 @@ var ErrNoMorePages = errors.New("spotify: no more pages")
 // This file contains the types that implement Spotify's paging object.
 // See: https://developer.spotify.com/web-api/object-model/#paging-object
 
-// basePage contains all of the fields in a Spotify paging object, except
+// PageBase contains all of the fields in a Spotify paging object, except
 // for the actual items.  This type is meant to be embedded in other types
-// that add the Items field.
-type basePage struct {
+// that add the Items field.  It is exported so that a page you already
+// have can be handed to AllPages.
+type PageBase struct {
 	// A link to the Web API Endpoint returning the full
 	// result of this request.
 	Endpoint string `json:"href"`
@@ -49,58 +52,119 @@ type basePage struct {
 
 // FullArtistPage contains FullArtists returned by the Web API.
 type FullArtistPage struct {
-	basePage
+	PageBase
 	Artists []FullArtist `json:"items"`
 }
 
 // SimpleAlbumPage contains SimpleAlbums returned by the Web API.
 type SimpleAlbumPage struct {
-	basePage
+	PageBase
 	Albums []SimpleAlbum `json:"items"`
 }
 
 // SimplePlaylistPage contains SimplePlaylists returned by the Web API.
 type SimplePlaylistPage struct {
-	basePage
+	PageBase
 	Playlists []SimplePlaylist `json:"items"`
 }
 
 // SimpleTrackPage contains SimpleTracks returned by the Web API.
 type SimpleTrackPage struct {
-	basePage
+	PageBase
 	Tracks []SimpleTrack `json:"items"`
 }
 
 // FullTrackPage contains FullTracks returned by the Web API.
 type FullTrackPage struct {
-	basePage
+	PageBase
 	Tracks []FullTrack `json:"items"`
 }
 
 // SavedTrackPage contains SavedTracks return by the Web API.
 type SavedTrackPage struct {
-	basePage
+	PageBase
 	Tracks []SavedTrack `json:"items"`
 }
 
 // PlaylistTrackPage contains information about tracks in a playlist.
 type PlaylistTrackPage struct {
-	basePage
+	PageBase
 	Tracks []PlaylistTrack `json:"items"`
 }
 
 // CategoryPage contains Category objects returned by the Web API.
 type CategoryPage struct {
-	basePage
+	PageBase
 	Categories []Category `json:"items"`
 }
 
 // getPage GETs the data at the specified URL and unmarshals it into page.
 func (c *Client) getPage(url string, page interface{}) error {
-	resp, err := c.http.Get(url)
+	return c.getPageContext(context.Background(), url, page)
+}
+
+// getPageContext is like getPage, but the request is bound to ctx.
+func (c *Client) getPageContext(ctx context.Context, url string, page interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req.WithContext(ctx))
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
-	return json.NewDecoder(resp.Body).Decode(page)
+	if resp.StatusCode != http.StatusOK {
+		return decodeError(resp)
+	}
+	return c.decode(resp.Body, page)
+}
+
+// pageTotal fetches a single item from the paged endpoint at url and
+// returns the total number of items available.
+func (c *Client) pageTotal(url string) (int, error) {
+	var page struct {
+		PageBase
+		Items json.RawMessage `json:"items"`
+	}
+	if err := c.getPage(url+"?limit=1", &page); err != nil {
+		return 0, err
+	}
+	return page.Total, nil
+}
+
+// AllPages fetches the rest of a paged Web API endpoint, following the
+// Next link of first (typically the embedded PageBase of a page you already
+// have, such as &page.PageBase), and calls each with the raw JSON of every
+// following page's items array, in order.  The items of first itself are
+// not passed to each.  It can be used with endpoints that this package
+// doesn't have an "All" helper for, decoding the items into any type.  To
+// walk an endpoint from the start, pass a PageBase whose Next is its URL;
+// like GetRaw, a Next relative to the client's base URL (for example
+// "me/tracks?limit=50") is accepted.
+//
+// AllPages stops at the first error, including one returned by each, and
+// returns it.
+func (c *Client) AllPages(ctx context.Context, first *PageBase, each func(items json.RawMessage) error) error {
+	if first == nil || first.Next == "" {
+		return nil
+	}
+	next := c.resolveURL(first.Next)
+	for next != "" {
+		var page struct {
+			PageBase
+			Items json.RawMessage `json:"items"`
+		}
+		if err := c.getPageContext(ctx, next, &page); err != nil {
+			return err
+		}
+		if err := each(page.Items); err != nil {
+			return err
+		}
+		next = page.Next
+	}
+	return nil
 }
@@ -0,0 +1,105 @@
+// Copyright 2014, 2015 Zac Bergquist
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spotify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestAllPages(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"items": [ { "id": "a" }, { "id": "b" } ],
+			"next": "https://api.spotify.com/v1/me/shows?offset=2&limit=2"
+		}`},
+		cannedResponse{statusCode: http.StatusOK, body: `{ "items": [ { "id": "c" } ] }`},
+	)
+	var ids []string
+	err := client.AllPages(context.Background(), &PageBase{Next: "me/shows?limit=2"}, func(items json.RawMessage) error {
+		var page []struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(items, &page); err != nil {
+			return err
+		}
+		for _, item := range page {
+			ids = append(ids, item.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[2] != "c" {
+		t.Errorf("Unexpected items %v", ids)
+	}
+	if u := rt.requests[0].URL.String(); u != "https://api.spotify.com/v1/me/shows?limit=2" {
+		t.Errorf("Unexpected first request %s", u)
+	}
+	if l := len(rt.requests); l != 2 {
+		t.Errorf("Expected 2 requests, got %d", l)
+	}
+}
+
+func TestAllPagesCallbackError(t *testing.T) {
+	client, rt := testClientSequence(cannedResponse{statusCode: http.StatusOK, body: `{
+		"items": [],
+		"next": "https://api.spotify.com/v1/me/shows?offset=2&limit=2"
+	}`})
+	stop := errors.New("stop")
+	err := client.AllPages(context.Background(), &PageBase{Next: "me/shows"}, func(json.RawMessage) error {
+		return stop
+	})
+	if err != stop {
+		t.Errorf("Expected the callback's error, got %v", err)
+	}
+	if l := len(rt.requests); l != 1 {
+		t.Errorf("Expected 1 request, got %d", l)
+	}
+}
+
+func TestAllPagesFromPage(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{ "items": [ { "id": "c" } ] }`},
+	)
+	var first SavedTrackPage
+	first.Next = "https://api.spotify.com/v1/me/tracks?offset=2&limit=2"
+	var calls int
+	err := client.AllPages(context.Background(), &first.PageBase, func(items json.RawMessage) error {
+		calls++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+	if u := rt.requests[0].URL.String(); u != first.Next {
+		t.Errorf("Expected to follow the page's Next link, got %s", u)
+	}
+
+	first.Next = ""
+	if err := client.AllPages(context.Background(), &first.PageBase, func(json.RawMessage) error {
+		t.Error("Expected no more pages")
+		return nil
+	}); err != nil {
+		t.Error(err)
+	}
+}
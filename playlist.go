@@ -16,12 +16,15 @@ package spotify
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // PlaylistTracks contains details about the tracks in a playlist.
@@ -36,7 +39,6 @@ type PlaylistTracks struct {
 // SimplePlaylist contains basic info about a Spotify playlist.
 type SimplePlaylist struct {
 	// Indicates whether the playlist owner allows others to modify the playlist.
-	// Note: only non-collaborative playlists are currently returned by Spotify's Web API.
 	Collaborative bool        `json:"collaborative"`
 	ExternalURLs  ExternalURL `json:"external_urls"`
 	// A link to the Web API endpoint providing full details of the playlist.
@@ -45,10 +47,14 @@ type SimplePlaylist struct {
 	// The playlist image.  Note: this field is only  returned for modified,
 	// verified playlists. Otherwise the slice is empty.  If returned, the source
 	// URL for the image is temporary and will expire in less than a day.
-	Images   []Image `json:"images"`
-	Name     string  `json:"name"`
-	Owner    User    `json:"owner"`
-	IsPublic bool    `json:"public"`
+	Images []Image `json:"images"`
+	Name   string  `json:"name"`
+	// The user who owns the playlist.  Together with Collaborative, this
+	// determines whether the current user can modify the playlist.
+	Owner User `json:"owner"`
+	// Indicates whether the playlist is public.  This is only meaningful
+	// for the current user's own playlists.
+	IsPublic bool `json:"public"`
 	// The version identifier for the current playlist. Can be supplied in other
 	// requests to target a specific playlist version.
 	SnapshotID string `json:"snapshot_id"`
@@ -68,6 +74,14 @@ type FullPlaylist struct {
 	Tracks    PlaylistTrackPage `json:"tracks"`
 }
 
+// ImageForWidth returns the playlist image best suited for display at a
+// width of px pixels: the smallest image that is at least px pixels wide,
+// or the largest image if none are wide enough.  It returns nil if the
+// playlist has no images.
+func (p *SimplePlaylist) ImageForWidth(px int) *Image {
+	return imageForWidth(p.Images, px)
+}
+
 // PlaylistOptions contains optional parameters that can be used when querying
 // for featured playlists.  Only the non-nil fields are used in the request.
 type PlaylistOptions struct {
@@ -78,6 +92,7 @@ type PlaylistOptions struct {
 	// parameter if you want the results returned in a particular
 	// language.  If not specified, the result will be returned
 	// in the Spotify default language (American English).
+	// A malformed locale results in ErrInvalidLocale.
 	Locale *string
 	// A timestamp in ISO 8601 format (yyyy-MM-ddTHH:mm:ss).
 	// use this paramter to specify the user's local time to
@@ -90,11 +105,17 @@ type PlaylistOptions struct {
 // FeaturedPlaylistsOpt gets a list of playlists featured by Spotify.
 // It accepts a number of optional parameters via the opt argument.
 // This call requires authorization.
+//
+// Spotify has deprecated this endpoint.  Applications that don't have
+// access to it get a DeprecatedEndpointError.
 func (c *Client) FeaturedPlaylistsOpt(opt *PlaylistOptions) (message string, playlists *SimplePlaylistPage, e error) {
-	spotifyURL := baseAddress + "browse/featured-playlists"
+	spotifyURL := c.baseURL() + "browse/featured-playlists"
 	if opt != nil {
 		v := url.Values{}
 		if opt.Locale != nil {
+			if !validLocale(*opt.Locale) {
+				return "", nil, ErrInvalidLocale
+			}
 			v.Set("locale", *opt.Locale)
 		}
 		if opt.Country != nil {
@@ -113,19 +134,19 @@ func (c *Client) FeaturedPlaylistsOpt(opt *PlaylistOptions) (message string, pla
 			spotifyURL += "?" + params
 		}
 	}
-	resp, err := c.http.Get(spotifyURL)
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return "", nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return "", nil, decodeError(resp.Body)
+		return "", nil, deprecated("FeaturedPlaylists", decodeError(resp))
 	}
 	var result struct {
 		Playlists SimplePlaylistPage `json:"playlists"`
 		Message   string             `json:"message"`
 	}
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	err = c.decode(resp.Body, &result)
 	if err != nil {
 		return "", nil, err
 	}
@@ -147,20 +168,20 @@ func (c *Client) FeaturedPlaylists() (message string, playlists *SimplePlaylistP
 // must have granted the ScopePlaylistModifyPrivate scope.  The
 // ScopePlaylistModifyPublic scope is required to follow playlists publicly.
 func (c *Client) FollowPlaylist(owner ID, playlist ID, public bool) error {
-	spotifyURL := buildFollowURI(owner, playlist)
+	spotifyURL := c.buildFollowURI(owner, playlist)
 	body := strings.NewReader(strconv.FormatBool(public))
 	req, err := http.NewRequest("PUT", spotifyURL, body)
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return decodeError(resp.Body)
+		return decodeError(resp)
 	}
 	return nil
 }
@@ -170,33 +191,35 @@ func (c *Client) FollowPlaylist(owner ID, playlist ID, public bool) error {
 // requires the ScopePlaylistModifyPublic scope.  Unfolowing a privately followed,
 // playlist requies the ScopePlaylistModifyPrivate scope.
 func (c *Client) UnfollowPlaylist(owner, playlist ID) error {
-	spotifyURL := buildFollowURI(owner, playlist)
+	spotifyURL := c.buildFollowURI(owner, playlist)
 	req, err := http.NewRequest("DELETE", spotifyURL, nil)
 	if err != nil {
 		return err
 	}
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return decodeError(resp.Body)
+		return decodeError(resp)
 	}
 	return nil
 }
 
-func buildFollowURI(owner, playlist ID) string {
+func (c *Client) buildFollowURI(owner, playlist ID) string {
 	return fmt.Sprintf("%susers/%s/playlists/%s/followers",
-		baseAddress, string(owner), string(playlist))
+		c.baseURL(), string(owner), string(playlist))
 }
 
 // GetPlaylistsForUser gets a list of the playlists owned or followed by a
 // particular Spotify user.  This call requires authorization.
 //
-// Private playlists and collaborative playlists are only retrievable for the
-// current user.  In order to read private playlists, the user must have granted
-// the ScopePlaylistReadPrivate scope.  Note that this scope alone will not
+// For any user other than the current user, only public playlists are
+// returned.  Private playlists and collaborative playlists are only
+// retrievable for the current user (see CurrentUsersPlaylists).  In order to
+// read private playlists, the user must have granted the
+// ScopePlaylistReadPrivate scope.  Note that this scope alone will not
 // return collaborative playlists, even though they are always private.  In
 // order to read collaborative playlists, the user must have granted the
 // ScopePlaylistReadCollaborative scope.
@@ -207,7 +230,141 @@ func (c *Client) GetPlaylistsForUser(userID string) (*SimplePlaylistPage, error)
 // GetPlaylistsForUserOpt is like PlaylistsForUser, but it accepts optional paramters
 // for filtering the results.
 func (c *Client) GetPlaylistsForUserOpt(userID string, opt *Options) (*SimplePlaylistPage, error) {
-	spotifyURL := baseAddress + "users/" + userID + "/playlists"
+	return c.getPlaylists(c.baseURL()+"users/"+userID+"/playlists", opt)
+}
+
+// CurrentUsersPlaylists gets a list of the playlists owned or followed by
+// the current Spotify user.  This call requires authorization.
+//
+// Unlike GetPlaylistsForUser, the result can include the user's private
+// playlists (which requires the ScopePlaylistReadPrivate scope) and
+// collaborative playlists (which requires the ScopePlaylistReadCollaborative
+// scope).
+//
+// Playlists are returned in the order Spotify keeps them for the user,
+// which roughly matches the order in the Spotify app's sidebar.  Playlist
+// folders aren't available through the Web API: playlists inside a folder
+// are returned as if they weren't in one, and nothing in the response
+// tells where a folder starts or ends.
+func (c *Client) CurrentUsersPlaylists() (*SimplePlaylistPage, error) {
+	return c.CurrentUsersPlaylistsOpt(nil)
+}
+
+// CurrentUsersPlaylistsOpt is like CurrentUsersPlaylists, but it accepts
+// optional parameters for filtering the results.
+func (c *Client) CurrentUsersPlaylistsOpt(opt *Options) (*SimplePlaylistPage, error) {
+	return c.getPlaylists(c.baseURL()+"me/playlists", opt)
+}
+
+// CurrentUsersEditablePlaylists gets the playlists that the current Spotify
+// user can add tracks to: the ones they own, and the collaborative ones they
+// follow.  It follows the paging links until all of the user's playlists
+// have been fetched.  Limit, if set, controls the page size (the default is
+// 50), and Offset is ignored.
+//
+// This call requires authorization.  Private and collaborative playlists
+// are only included if the application has the ScopePlaylistReadPrivate and
+// ScopePlaylistReadCollaborative scopes.
+func (c *Client) CurrentUsersEditablePlaylists(opt *Options) ([]SimplePlaylist, error) {
+	me, err := c.CurrentUser()
+	if err != nil {
+		return nil, err
+	}
+	first := Options{}
+	if opt != nil {
+		first.Limit = opt.Limit
+	}
+	if first.Limit == nil {
+		limit := 50
+		first.Limit = &limit
+	}
+	page, err := c.CurrentUsersPlaylistsOpt(&first)
+	if err != nil {
+		return nil, err
+	}
+	var playlists []SimplePlaylist
+	for {
+		for _, p := range page.Playlists {
+			if p.Owner.ID == me.ID || p.Collaborative {
+				playlists = append(playlists, p)
+			}
+		}
+		if page.Next == "" {
+			return playlists, nil
+		}
+		next := page.Next
+		page = &SimplePlaylistPage{}
+		if err := c.getPage(next, page); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// CurrentUsersPlaylistsCount returns the number of playlists owned or
+// followed by the current Spotify user.  This call requires authorization.
+func (c *Client) CurrentUsersPlaylistsCount() (int, error) {
+	return c.pageTotal(c.baseURL() + "me/playlists")
+}
+
+// PlaylistStream delivers playlists as their pages are fetched.  See
+// StreamCurrentUsersPlaylists.
+type PlaylistStream struct {
+	// Playlists receives the playlists in order.  It is closed once
+	// every page has been fetched, or when an error occurs.
+	Playlists <-chan SimplePlaylist
+
+	err error
+}
+
+// Err returns the error that stopped the stream, if any.  It must only
+// be called after Playlists has been closed.
+func (s *PlaylistStream) Err() error {
+	return s.err
+}
+
+// StreamCurrentUsersPlaylists is like CurrentUsersPlaylists, but it follows
+// the paging links in the background and sends each playlist on the
+// returned stream as soon as its page arrives, so the results can be consumed
+// with a range loop:
+//
+//     stream := client.StreamCurrentUsersPlaylists(ctx)
+//     for p := range stream.Playlists {
+//         ...
+//     }
+//     if err := stream.Err(); err != nil {
+//         ...
+//     }
+//
+// Cancelling ctx stops the stream.  The consumer must either drain
+// Playlists or cancel ctx, or the goroutine fetching the pages will
+// never exit.
+func (c *Client) StreamCurrentUsersPlaylists(ctx context.Context) *PlaylistStream {
+	ch := make(chan SimplePlaylist)
+	stream := &PlaylistStream{Playlists: ch}
+	go func() {
+		defer close(ch)
+		next := c.baseURL() + "me/playlists?limit=50"
+		for next != "" {
+			var page SimplePlaylistPage
+			if err := c.getPageContext(ctx, next, &page); err != nil {
+				stream.err = err
+				return
+			}
+			for _, p := range page.Playlists {
+				select {
+				case ch <- p:
+				case <-ctx.Done():
+					stream.err = ctx.Err()
+					return
+				}
+			}
+			next = page.Next
+		}
+	}()
+	return stream
+}
+
+func (c *Client) getPlaylists(spotifyURL string, opt *Options) (*SimplePlaylistPage, error) {
 	if opt != nil {
 		v := url.Values{}
 		if opt.Limit != nil {
@@ -220,16 +377,16 @@ func (c *Client) GetPlaylistsForUserOpt(userID string, opt *Options) (*SimplePla
 			spotifyURL += "?" + params
 		}
 	}
-	resp, err := c.http.Get(spotifyURL)
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var result SimplePlaylistPage
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	err = c.decode(resp.Body, &result)
 	return &result, err
 }
 
@@ -259,20 +416,57 @@ func (c *Client) GetPlaylist(userID string, playlistID ID) (*FullPlaylist, error
 // Fields can be excluded by prefixing them with an exclamation mark, for example;
 //    fields = "tracks.items(track(name,href,album(!name,href)))"
 func (c *Client) GetPlaylistOpt(userID string, playlistID ID, fields string) (*FullPlaylist, error) {
-	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s", baseAddress, userID, playlistID)
+	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s", c.baseURL(), userID, playlistID)
 	if fields != "" {
 		spotifyURL += "?fields=" + url.QueryEscape(fields)
 	}
-	resp, err := c.http.Get(spotifyURL)
+	return c.getPlaylist(spotifyURL)
+}
+
+// GetPlaylistForMarket is like GetPlaylistOpt, but the playlist's tracks
+// are returned as they appear in the specified market (an ISO 3166-1
+// alpha-2 country code, or MarketFromToken to use the current user's
+// country).  Each track then reports whether it is playable there, and
+// tracks that were relinked to another version have LinkedFrom set.
+func (c *Client) GetPlaylistForMarket(userID string, playlistID ID, market, fields string) (*FullPlaylist, error) {
+	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s", c.baseURL(), userID, playlistID)
+	v := url.Values{}
+	if market != "" {
+		v.Set("market", market)
+	}
+	if fields != "" {
+		v.Set("fields", fields)
+	}
+	if params := v.Encode(); params != "" {
+		spotifyURL += "?" + params
+	}
+	return c.getPlaylist(spotifyURL)
+}
+
+// VerifyPlaylistSnapshot reports whether snapshotID identifies the current
+// version of a playlist.  Call it before editing a playlist based on a copy
+// you fetched earlier: if it returns false, the playlist has been changed in
+// the meantime and should be fetched again.  Only the playlist's snapshot
+// ID is requested.
+func (c *Client) VerifyPlaylistSnapshot(playlistID ID, snapshotID string) (bool, error) {
+	playlist, err := c.getPlaylist(c.baseURL() + "playlists/" + string(playlistID) + "?fields=snapshot_id")
+	if err != nil {
+		return false, err
+	}
+	return playlist.SnapshotID == snapshotID, nil
+}
+
+func (c *Client) getPlaylist(spotifyURL string) (*FullPlaylist, error) {
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var playlist FullPlaylist
-	err = json.NewDecoder(resp.Body).Decode(&playlist)
+	err = c.decode(resp.Body, &playlist)
 	return &playlist, err
 }
 
@@ -301,10 +495,14 @@ func (c *Client) GetPlaylistTracks(userID string, playlistID ID) (*PlaylistTrack
 //
 // Fields can be excluded by prefixing them with an exclamation mark.  For example:
 //     fields = "items.track.album(!external_urls,images)"
+//
+// If the Country option is specified, the tracks are returned as they
+// appear in that market: each track reports whether it is playable there,
+// and tracks that were relinked to another version have LinkedFrom set.
 func (c *Client) GetPlaylistTracksOpt(userID string, playlistID ID,
 	opt *Options, fields string) (*PlaylistTrackPage, error) {
 
-	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s/tracks", baseAddress, userID, playlistID)
+	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s/tracks", c.baseURL(), userID, playlistID)
 	v := url.Values{}
 	if fields != "" {
 		v.Set("fields", fields)
@@ -316,23 +514,87 @@ func (c *Client) GetPlaylistTracksOpt(userID string, playlistID ID,
 		if opt.Offset != nil {
 			v.Set("offset", strconv.Itoa(*opt.Offset))
 		}
+		if opt.Country != nil {
+			v.Set("market", *opt.Country)
+		}
 	}
 	if params := v.Encode(); params != "" {
 		spotifyURL += "?" + params
 	}
-	resp, err := c.http.Get(spotifyURL)
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var result PlaylistTrackPage
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	err = c.decode(resp.Body, &result)
 	return &result, err
 }
 
+// PlaylistDuration returns the combined length of the tracks in a playlist.
+// Items whose duration isn't known (for example, tracks that are no longer
+// available) are skipped.  To get the duration of an entire playlist, all
+// of its pages must be included in tracks.
+func PlaylistDuration(tracks []PlaylistTrack) time.Duration {
+	var total time.Duration
+	for i := range tracks {
+		if d := tracks[i].Track.Duration; d > 0 {
+			total += tracks[i].Track.TimeDuration()
+		}
+	}
+	return total
+}
+
+// DiffPlaylists compares two versions of a playlist's tracks, for example
+// before and after some edits.  Tracks are compared by URI, and a track that
+// appears more times in after than in before is reported as added once for
+// each extra occurrence (and vice versa for removed tracks).  Added tracks
+// are listed in the order they appear in after; removed tracks in the order
+// they appeared in before.  Added and removed tracks are reported by URI,
+// since local files in a playlist have no ID.
+//
+// Reordered is true if the tracks present in both versions appear in a
+// different order.
+func DiffPlaylists(before, after []PlaylistTrack) (added, removed []URI, reordered bool) {
+	beforeCount := make(map[URI]int)
+	for i := range before {
+		beforeCount[before[i].Track.URI]++
+	}
+	afterCount := make(map[URI]int)
+	for i := range after {
+		afterCount[after[i].Track.URI]++
+	}
+
+	// kept returns the tracks that are in both versions, in order,
+	// and appends any others to extra
+	kept := func(tracks []PlaylistTrack, other map[URI]int, extra *[]URI) []URI {
+		var result []URI
+		seen := make(map[URI]int)
+		for i := range tracks {
+			uri := tracks[i].Track.URI
+			seen[uri]++
+			if seen[uri] > other[uri] {
+				*extra = append(*extra, uri)
+			} else {
+				result = append(result, uri)
+			}
+		}
+		return result
+	}
+	keptBefore := kept(before, afterCount, &removed)
+	keptAfter := kept(after, beforeCount, &added)
+	for i := range keptBefore {
+		if keptBefore[i] != keptAfter[i] {
+			reordered = true
+			break
+		}
+	}
+	return added, removed, reordered
+}
+
 // CreatePlaylistForUser creates a playlist for a Spotify user.
 // The playlist will be empty until you add tracks to it.
 // The playlistName does not need to be unique - a user can have
@@ -345,7 +607,7 @@ func (c *Client) GetPlaylistTracksOpt(userID string, playlistID ID,
 //
 // On success, the newly created playlist is returned.
 func (c *Client) CreatePlaylistForUser(userID, playlistName string, public bool) (*FullPlaylist, error) {
-	spotifyURL := fmt.Sprintf("%susers/%s/playlists", baseAddress, userID)
+	spotifyURL := fmt.Sprintf("%susers/%s/playlists", c.baseURL(), userID)
 	body := struct {
 		Name   string `json:"name"`
 		Public bool   `json:"public"`
@@ -362,16 +624,16 @@ func (c *Client) CreatePlaylistForUser(userID, playlistName string, public bool)
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var p FullPlaylist
-	err = json.NewDecoder(resp.Body).Decode(&p)
+	err = c.decode(resp.Body, &p)
 	return &p, err
 }
 
@@ -411,53 +673,79 @@ func (c *Client) modifyPlaylist(userID string, playlistID ID, newName string, pu
 	if err != nil {
 		return err
 	}
-	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s", baseAddress, userID, string(playlistID))
+	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s", c.baseURL(), userID, string(playlistID))
 	req, err := http.NewRequest("PUT", spotifyURL, bytes.NewReader(bodyJSON))
 	if err != nil {
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return decodeError(resp.Body)
+		return decodeError(resp)
 	}
 	return nil
 }
 
 // AddTracksToPlaylist adds one or more tracks to a user's playlist.  This call
 // requires authorization (ScopePlaylistModifyPublic or ScopePlaylistModifyPrivate).
-// A maximum of 100 tracks can be added per call.  It returns a snapshot ID that
-// can be used to identify this version (the new version) of the playlist in
-// future requests.
+// It returns a snapshot ID that can be used to identify this version (the new
+// version) of the playlist in future requests.
+//
+// The Web API accepts at most 100 tracks per request, so larger lists are
+// added in batches of 100, one request after the other.  The tracks are
+// appended in the order given, and the snapshot ID of the final batch is
+// returned.  If a batch fails, the tracks from earlier batches remain in
+// the playlist.  If no tracks are given, no request is made and the snapshot
+// ID is empty.
 func (c *Client) AddTracksToPlaylist(userID string, playlistID ID,
 	trackIDs ...ID) (snapshotID string, err error) {
 
+	if len(trackIDs) == 0 {
+		return "", nil
+	}
 	uris := make([]string, len(trackIDs))
 	for i, id := range trackIDs {
-		uris[i] = fmt.Sprintf("spotify:track:%s", id)
+		uris[i] = string(TrackURI(id))
+	}
+	for {
+		n := len(uris)
+		if n > 100 {
+			n = 100
+		}
+		snapshotID, err = c.addTracksToPlaylist(userID, playlistID, uris[:n])
+		if err != nil {
+			return "", err
+		}
+		uris = uris[n:]
+		if len(uris) == 0 {
+			return snapshotID, nil
+		}
 	}
-	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s/tracks?urls=%s",
-		baseAddress, userID, string(playlistID), strings.Join(uris, ","))
+}
+
+func (c *Client) addTracksToPlaylist(userID string, playlistID ID, uris []string) (string, error) {
+	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s/tracks?uris=%s",
+		c.baseURL(), userID, string(playlistID), strings.Join(uris, ","))
 	req, err := http.NewRequest("POST", spotifyURL, nil)
 	if err != nil {
 		return "", err
 	}
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusCreated {
-		return "", decodeError(resp.Body)
+		return "", decodeError(resp)
 	}
 	body := struct {
 		SnapshotID string `json:"snapshot_id"`
 	}{}
-	err = json.NewDecoder(resp.Body).Decode(&body)
+	err = c.decode(resp.Body, &body)
 	if err != nil {
 		// the response code indicates success..
 		return "", err
@@ -471,7 +759,8 @@ func (c *Client) AddTracksToPlaylist(userID string, playlistID ID,
 //
 // If the track(s) occur multiple times in the specified playlist, then all occurrences
 // of the track will be removed.  If successful, the snapshot ID returned can be used to
-// identify the playlist version in future requests.
+// identify the playlist version in future requests.  To remove a track from
+// specific positions only, use RemoveTracksFromPlaylistOpt.
 func (c *Client) RemoveTracksFromPlaylist(userID string, playlistID ID,
 	trackIDs ...ID) (newSnapshotID string, err error) {
 
@@ -480,11 +769,43 @@ func (c *Client) RemoveTracksFromPlaylist(userID string, playlistID ID,
 	}, len(trackIDs))
 
 	for i, u := range trackIDs {
-		tracks[i].URI = fmt.Sprintf("spotify:track:%s", u)
+		tracks[i].URI = string(TrackURI(u))
 	}
 	return c.removeTracksFromPlaylist(userID, playlistID, tracks, "")
 }
 
+// RemoveAllOccurrences removes every occurrence of the specified tracks from
+// a playlist, wherever they appear in it.  Unlike RemoveTracksFromPlaylistOpt,
+// it sends only the track URIs and no positions, which Spotify treats as
+// "remove all matching items".  It doesn't need the playlist owner's ID.
+//
+// Tracks are removed up to 100 at a time.  The returned snapshot ID is the
+// one returned by the last request.  If a request fails, the tracks in
+// earlier requests have already been removed.
+//
+// This call requires that the user has authorized the ScopePlaylistModifyPublic
+// or ScopePlaylistModifyPrivate scopes.
+func (c *Client) RemoveAllOccurrences(playlistID ID, trackIDs ...ID) (snapshotID string, err error) {
+	spotifyURL := c.baseURL() + "playlists/" + string(playlistID) + "/tracks"
+	for start := 0; start < len(trackIDs); start += 100 {
+		end := start + 100
+		if end > len(trackIDs) {
+			end = len(trackIDs)
+		}
+		tracks := make([]struct {
+			URI string `json:"uri"`
+		}, end-start)
+		for i, id := range trackIDs[start:end] {
+			tracks[i].URI = string(TrackURI(id))
+		}
+		snapshotID, err = c.removeTracks(spotifyURL, tracks, "")
+		if err != nil {
+			return "", err
+		}
+	}
+	return snapshotID, nil
+}
+
 // TrackToRemove specifies a track to be removed from a playlist.
 // Positions is a slice of 0-based track indices.
 // TrackToRemove is used with RemoveTracksFromPlaylistOpt.
@@ -497,7 +818,7 @@ type TrackToRemove struct {
 // track ID and playlist locations.
 func NewTrackToRemove(trackID string, positions []int) TrackToRemove {
 	return TrackToRemove{
-		URI:       fmt.Sprintf("spotify:track:%s", trackID),
+		URI:       string(TrackURI(ID(trackID))),
 		Positions: positions,
 	}
 }
@@ -505,7 +826,8 @@ func NewTrackToRemove(trackID string, positions []int) TrackToRemove {
 // RemoveTracksFromPlaylistOpt is like RemoveTracksFromPlaylist, but it supports
 // optional parameters that offer more fine-grained control.  Instead of deleting
 // all occurrences of a track, this function takes an index with each track URI
-// that indicates the position of the track in the playlist.
+// that indicates the position of the track in the playlist.  Occurrences of
+// the track at other positions are left in place.
 //
 // In addition, the snapshotID parameter allows you to specify the snapshot ID
 // against which you want to make the changes.  Spotify will validate that the
@@ -523,38 +845,143 @@ func (c *Client) RemoveTracksFromPlaylistOpt(userID string, playlistID ID,
 func (c *Client) removeTracksFromPlaylist(userID string, playlistID ID,
 	tracks interface{}, snapshotID string) (newSnapshotID string, err error) {
 
+	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s/tracks",
+		c.baseURL(), userID, string(playlistID))
+	return c.removeTracks(spotifyURL, tracks, snapshotID)
+}
+
+// removeTracks sends the request to remove tracks from the playlist tracks
+// endpoint at spotifyURL.
+func (c *Client) removeTracks(spotifyURL string, tracks interface{}, snapshotID string) (newSnapshotID string, err error) {
 	m := make(map[string]interface{})
 	m["tracks"] = tracks
 	if snapshotID != "" {
 		m["snapshot_id"] = snapshotID
 	}
 
-	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s/tracks",
-		baseAddress, userID, string(playlistID))
 	body, err := json.Marshal(m)
 	if err != nil {
 		return "", err
 	}
 	req, err := http.NewRequest("DELETE", spotifyURL, bytes.NewReader(body))
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return "", decodeError(resp.Body)
+		return "", decodeError(resp)
 	}
 	result := struct {
 		SnapshotID string `json:"snapshot_id"`
 	}{}
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	err = c.decode(resp.Body, &result)
 	return result.SnapshotID, err
 }
 
+// PlaylistItemsAddedBetween returns the items of a playlist that were added
+// at or after from and before to, in playlist order.  Items without an added
+// date, which very old playlists can contain, are never included.
+//
+// All of the playlist's items are fetched.  Items are only in the order they
+// were added until the playlist is reordered, so paging can't stop early
+// once an item outside the range is seen.
+func (c *Client) PlaylistItemsAddedBetween(playlistID ID, from, to time.Time) ([]PlaylistTrack, error) {
+	var items []PlaylistTrack
+	next := c.baseURL() + "playlists/" + string(playlistID) + "/tracks?limit=100"
+	for next != "" {
+		var page PlaylistTrackPage
+		if err := c.getPage(next, &page); err != nil {
+			return nil, err
+		}
+		for _, item := range page.Tracks {
+			added := item.AddedAtTime()
+			if added.IsZero() || added.Before(from) || !added.Before(to) {
+				continue
+			}
+			items = append(items, item)
+		}
+		next = page.Next
+	}
+	return items, nil
+}
+
+// DedupePlaylist removes duplicate items from a playlist, keeping the first
+// occurrence of each.  Items are compared by URI, so local tracks and
+// episodes are handled like any other item, and items Spotify returns
+// without a URI are ignored.  It returns the number of items removed.
+//
+// The duplicates are removed by position, up to 100 at a time, starting
+// from the end of the playlist so that earlier positions don't shift
+// between requests.  Each request is pinned to the snapshot returned by the
+// previous one, so if the playlist is edited while DedupePlaylist runs
+// Spotify rejects the removal instead of deleting the wrong items.  If a
+// request fails, the items in earlier requests have already been removed.
+//
+// This call requires that the user has authorized the ScopePlaylistModifyPublic
+// or ScopePlaylistModifyPrivate scopes.
+func (c *Client) DedupePlaylist(playlistID ID) (removed int, err error) {
+	playlistURL := c.baseURL() + "playlists/" + string(playlistID)
+	playlist, err := c.getPlaylist(playlistURL + "?fields=snapshot_id")
+	if err != nil {
+		return 0, err
+	}
+	snapshotID := playlist.SnapshotID
+
+	type duplicate struct {
+		uri      string
+		position int
+	}
+	var duplicates []duplicate
+	seen := make(map[URI]bool)
+	position := 0
+	next := playlistURL + "/tracks?limit=100&fields=" + url.QueryEscape("items(track(uri)),next")
+	for next != "" {
+		var page PlaylistTrackPage
+		if err := c.getPage(next, &page); err != nil {
+			return 0, err
+		}
+		for _, item := range page.Tracks {
+			if uri := item.Track.URI; uri != "" {
+				if seen[uri] {
+					duplicates = append(duplicates, duplicate{string(uri), position})
+				}
+				seen[uri] = true
+			}
+			position++
+		}
+		next = page.Next
+	}
+
+	for end := len(duplicates); end > 0; end -= 100 {
+		start := end - 100
+		if start < 0 {
+			start = 0
+		}
+		var tracks []TrackToRemove
+		index := make(map[string]int)
+		for _, d := range duplicates[start:end] {
+			i, ok := index[d.uri]
+			if !ok {
+				i = len(tracks)
+				index[d.uri] = i
+				tracks = append(tracks, TrackToRemove{URI: d.uri})
+			}
+			tracks[i].Positions = append(tracks[i].Positions, d.position)
+		}
+		snapshotID, err = c.removeTracks(playlistURL+"/tracks", tracks, snapshotID)
+		if err != nil {
+			return removed, err
+		}
+		removed += end - start
+	}
+	return removed, nil
+}
+
 // ReplacePlaylistTracks replaces all of the tracks in a playlist, overwriting its
 // exising tracks  This can be useful for replacing or reordering tracks, or for
 // clearing a playlist.  This call requires authorization.
@@ -568,21 +995,21 @@ func (c *Client) removeTracksFromPlaylist(userID string, playlistID ID,
 func (c *Client) ReplacePlaylistTracks(userID string, playlistID ID, trackIDs ...ID) error {
 	trackURIs := make([]string, len(trackIDs))
 	for i, u := range trackIDs {
-		trackURIs[i] = fmt.Sprintf("spotify:track:%s", u)
+		trackURIs[i] = string(TrackURI(u))
 	}
 	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s/tracks?uris=%s",
-		baseAddress, userID, playlistID, strings.Join(trackURIs, ","))
+		c.baseURL(), userID, playlistID, strings.Join(trackURIs, ","))
 	req, err := http.NewRequest("PUT", spotifyURL, nil)
 	if err != nil {
 		return err
 	}
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusCreated {
-		return decodeError(resp.Body)
+		return decodeError(resp)
 	}
 	return nil
 }
@@ -594,20 +1021,72 @@ func (c *Client) ReplacePlaylistTracks(userID string, playlistID ID, trackIDs ..
 // Checking if a user follows a playlist publicly doesn't require any scopes.
 // Checking if the user is privately following a playlist is only possible for the
 // current user when that user has granted access to the ScopePlaylistReadPrivate scope.
+//
+// The result always contains one value for each user ID, in the order the
+// IDs were specified (see ErrUnexpectedResultCount).
 func (c *Client) UserFollowsPlaylist(ownerID string, playlistID ID, userIDs ...string) ([]bool, error) {
 	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s/followers/contains?ids=%s",
-		baseAddress, ownerID, playlistID, strings.Join(userIDs, ","))
-	resp, err := c.http.Get(spotifyURL)
+		c.baseURL(), ownerID, playlistID, strings.Join(userIDs, ","))
+	return c.getContains(spotifyURL, len(userIDs))
+}
+
+// PlaylistsFollowedBy checks whether a Spotify user follows each of the given
+// playlists.  The Web API can only check one playlist per request, so the
+// requests are made concurrently, a few at a time (and subject to any limit
+// set with SetMaxConcurrency).  The result is keyed by playlist ID.  If any
+// request fails, the remaining ones are skipped and the first error is
+// returned.  This call requires authorization.
+func (c *Client) PlaylistsFollowedBy(userID ID, playlistIDs ...ID) (map[ID]bool, error) {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		result   = make(map[ID]bool, len(playlistIDs))
+		sem      = make(chan struct{}, containsConcurrency)
+	)
+	for _, id := range playlistIDs {
+		wg.Add(1)
+		go func(id ID) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			mu.Lock()
+			failed := firstErr != nil
+			mu.Unlock()
+			if failed {
+				return
+			}
+			spotifyURL := fmt.Sprintf("%splaylists/%s/followers/contains?ids=%s", c.baseURL(), id, userID)
+			follows, err := c.getContains(spotifyURL, 1)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && err != ErrUnexpectedResultCount {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			result[id] = follows[0]
+		}(id)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return result, nil
+}
+
+// getContains fetches the result of a contains endpoint that checks n items.
+func (c *Client) getContains(spotifyURL string, n int) ([]bool, error) {
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
-	follows := make([]bool, len(userIDs))
-	err = json.NewDecoder(resp.Body).Decode(&follows)
-	return follows, err
+	return c.decodeContains(resp.Body, n)
 }
 
 // PlaylistReorderOptions is used with ReorderPlaylistTracks to reorder
@@ -649,7 +1128,7 @@ type PlaylistReorderOptions struct {
 // the user's private playlists (including collaborative playlists) requires
 // ScopePlaylistModifyPrivate.
 func (c *Client) ReorderPlaylistTracks(userID, playlistID ID, opt PlaylistReorderOptions) (snapshotID string, err error) {
-	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s/tracks", baseAddress, userID, playlistID)
+	spotifyURL := fmt.Sprintf("%susers/%s/playlists/%s/tracks", c.baseURL(), userID, playlistID)
 	j, err := json.Marshal(opt)
 	if err != nil {
 		return "", err
@@ -659,17 +1138,17 @@ func (c *Client) ReorderPlaylistTracks(userID, playlistID ID, opt PlaylistReorde
 		return "", err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return "", decodeError(resp.Body)
+		return "", decodeError(resp)
 	}
 	result := struct {
 		SnapshotID string `json:"snapshot_id"`
 	}{}
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	err = c.decode(resp.Body, &result)
 	return result.SnapshotID, err
 }
@@ -15,10 +15,13 @@
 package spotify
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -95,6 +98,22 @@ func TestPlaylistsForUser(t *testing.T) {
 	}
 }
 
+func TestCurrentUsersPlaylists(t *testing.T) {
+	client := testClientFile(http.StatusOK, "test_data/playlists_for_user.txt")
+	addDummyAuth(client)
+	playlists, err := client.CurrentUsersPlaylists()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if l := len(playlists.Playlists); l == 0 {
+		t.Error("Didn't get any results")
+	}
+	if path := getLastRequest(client).URL.Path; path != "/v1/me/playlists" {
+		t.Error("Expected request to /v1/me/playlists, got", path)
+	}
+}
+
 func TestGetPlaylistOpt(t *testing.T) {
 	client := testClientFile(http.StatusOK, "test_data/get_playlist_opt.txt")
 	addDummyAuth(client)
@@ -114,6 +133,54 @@ func TestGetPlaylistOpt(t *testing.T) {
 	}
 }
 
+func TestGetPlaylistTracksMarket(t *testing.T) {
+	client := testClientString(http.StatusOK, `{
+		"items": [{
+			"track": {
+				"id": "6kLCHFM39wkFjOuyPGLGeQ",
+				"is_playable": true,
+				"linked_from": {
+					"id": "2IA4WEsWAYpV9eKkwR2UYv",
+					"uri": "spotify:track:2IA4WEsWAYpV9eKkwR2UYv"
+				}
+			}
+		}],
+		"total": 1
+	}`)
+	addDummyAuth(client)
+	country := "DE"
+	page, err := client.GetPlaylistTracksOpt("user", "playlistID", &Options{Country: &country}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := getLastRequest(client).URL.Query().Get("market"); m != "DE" {
+		t.Errorf("Expected market DE, got %q", m)
+	}
+	track := page.Tracks[0].Track
+	if track.IsPlayable == nil || !*track.IsPlayable {
+		t.Error("Expected track to be playable")
+	}
+	if track.LinkedFrom == nil || track.LinkedFrom.ID != "2IA4WEsWAYpV9eKkwR2UYv" {
+		t.Errorf("Expected linked_from to be decoded, got %+v", track.LinkedFrom)
+	}
+}
+
+func TestGetPlaylistForMarket(t *testing.T) {
+	client := testClientString(http.StatusOK, `{"id": "playlistID"}`)
+	addDummyAuth(client)
+	_, err := client.GetPlaylistForMarket("user", "playlistID", MarketFromToken, "tracks.items(track(id,is_playable))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := getLastRequest(client).URL.Query()
+	if m := q.Get("market"); m != MarketFromToken {
+		t.Errorf("Expected market %q, got %q", MarketFromToken, m)
+	}
+	if f := q.Get("fields"); f != "tracks.items(track(id,is_playable))" {
+		t.Errorf("Unexpected fields %q", f)
+	}
+}
+
 func TestFollowPlaylistSetsContentType(t *testing.T) {
 	client := testClientString(http.StatusOK, "")
 	addDummyAuth(client)
@@ -273,6 +340,54 @@ func TestAddTracksToPlaylist(t *testing.T) {
 	}
 }
 
+func TestAddTracksToPlaylistNoTracks(t *testing.T) {
+	client, rt := testClientSequence(cannedResponse{statusCode: http.StatusCreated, body: `{ "snapshot_id": "s1" }`})
+	snapshot, err := client.AddTracksToPlaylist("user", "playlist_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot != "" {
+		t.Errorf("Expected no snapshot ID, got %s", snapshot)
+	}
+	if len(rt.requests) != 0 {
+		t.Errorf("Expected no requests, got %d", len(rt.requests))
+	}
+}
+
+func TestAddTracksToPlaylistBatches(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusCreated, body: `{ "snapshot_id": "s1" }`},
+		cannedResponse{statusCode: http.StatusCreated, body: `{ "snapshot_id": "s2" }`},
+		cannedResponse{statusCode: http.StatusCreated, body: `{ "snapshot_id": "s3" }`},
+	)
+	ids := make([]ID, 250)
+	for i := range ids {
+		ids[i] = ID(fmt.Sprintf("track%d", i))
+	}
+	snapshot, err := client.AddTracksToPlaylist("user", "playlist_id", ids...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot != "s3" {
+		t.Errorf("Expected the final snapshot ID, got %s", snapshot)
+	}
+	if len(rt.requests) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(rt.requests))
+	}
+	next := 0
+	for i, want := range []int{100, 100, 50} {
+		uris := strings.Split(rt.requests[i].URL.Query().Get("uris"), ",")
+		if len(uris) != want {
+			t.Errorf("Request %d: expected %d URIs, got %d", i, want, len(uris))
+			continue
+		}
+		if first := fmt.Sprintf("spotify:track:track%d", next); uris[0] != first {
+			t.Errorf("Request %d: expected to start with %s, got %s", i, first, uris[0])
+		}
+		next += want
+	}
+}
+
 func TestRemoveTracksFromPlaylist(t *testing.T) {
 	client := testClientString(http.StatusOK, `{ "snapshot_id" : "JbtmHBDBAYu3/bt8BOXKjzKx3i0b6LCa/wVjyl6qQ2Yf6nFXkbmzuEa+ZI/U1yF+" }`)
 	addDummyAuth(client)
@@ -319,6 +434,127 @@ func TestRemoveTracksFromPlaylist(t *testing.T) {
 	}
 }
 
+func TestRemoveAllOccurrences(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{ "snapshot_id": "first" }`},
+		cannedResponse{statusCode: http.StatusOK, body: `{ "snapshot_id": "second" }`},
+	)
+	ids := make([]ID, 150)
+	for i := range ids {
+		ids[i] = ID(fmt.Sprintf("track%d", i))
+	}
+	snapshotID, err := client.RemoveAllOccurrences("playlistID", ids...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshotID != "second" {
+		t.Errorf("Expected the last snapshot ID, got %q", snapshotID)
+	}
+	if len(rt.requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(rt.requests))
+	}
+	if req := rt.requests[0]; req.Method != "DELETE" || req.URL.Path != "/v1/playlists/playlistID/tracks" {
+		t.Errorf("Unexpected request %s %s", req.Method, req.URL.Path)
+	}
+	var body struct {
+		Tracks []map[string]interface{} `json:"tracks"`
+	}
+	if err := json.Unmarshal([]byte(rt.bodies[1]), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Tracks) != 50 {
+		t.Errorf("Expected 50 tracks in the second request, got %d", len(body.Tracks))
+	}
+	if _, ok := body.Tracks[0]["positions"]; ok {
+		t.Error("Expected no positions in the request body")
+	}
+}
+
+func TestPlaylistItemsAddedBetween(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"next": "https://api.spotify.com/v1/playlists/playlistID/tracks?offset=3&limit=3",
+			"items": [
+				{ "added_at": "2016-05-31T23:59:59Z", "track": { "id": "before" } },
+				{ "added_at": "2016-06-01T00:00:00Z", "track": { "id": "start" } },
+				{ "added_at": null, "track": { "id": "undated" } }
+			]
+		}`},
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"items": [
+				{ "added_at": "2016-07-01T00:00:00Z", "track": { "id": "end" } },
+				{ "added_at": "2016-06-15T12:00:00Z", "track": { "id": "moved" } }
+			]
+		}`},
+	)
+	from := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+	items, err := client.PlaylistItemsAddedBetween("playlistID", from, from.AddDate(0, 1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Track.ID != "start" || items[1].Track.ID != "moved" {
+		t.Errorf("Unexpected items %v", items)
+	}
+	if l := len(rt.requests); l != 2 {
+		t.Errorf("Expected 2 requests, got %d", l)
+	}
+}
+
+func TestDedupePlaylist(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{ "snapshot_id": "snap0" }`},
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"next": "https://api.spotify.com/v1/playlists/playlistID/tracks?offset=3&limit=3",
+			"items": [
+				{ "track": { "uri": "spotify:track:a" } },
+				{ "track": { "uri": "spotify:local:artist:album:song:180" } },
+				{ "track": { "uri": "spotify:track:a" } }
+			]
+		}`},
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"items": [
+				{ "track": null },
+				{ "track": { "uri": "spotify:local:artist:album:song:180" } },
+				{ "track": { "uri": "spotify:episode:e" } },
+				{ "track": { "uri": "spotify:track:a" } }
+			]
+		}`},
+		cannedResponse{statusCode: http.StatusOK, body: `{ "snapshot_id": "snap1" }`},
+	)
+	removed, err := client.DedupePlaylist("playlistID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 3 {
+		t.Errorf("Expected 3 duplicates to be removed, got %d", removed)
+	}
+	if len(rt.requests) != 4 {
+		t.Fatalf("Expected 4 requests, got %d", len(rt.requests))
+	}
+	if q := rt.requests[1].URL.Query().Get("fields"); q != "items(track(uri)),next" {
+		t.Errorf("Unexpected fields %q", q)
+	}
+	var body struct {
+		Tracks     []TrackToRemove `json:"tracks"`
+		SnapshotID string          `json:"snapshot_id"`
+	}
+	if err := json.Unmarshal([]byte(rt.bodies[3]), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.SnapshotID != "snap0" {
+		t.Errorf("Expected the removal to be pinned to snap0, got %q", body.SnapshotID)
+	}
+	if len(body.Tracks) != 2 {
+		t.Fatalf("Expected 2 tracks to remove, got %v", body.Tracks)
+	}
+	if tr := body.Tracks[0]; tr.URI != "spotify:track:a" || len(tr.Positions) != 2 || tr.Positions[0] != 2 || tr.Positions[1] != 6 {
+		t.Errorf("Unexpected removal %+v", tr)
+	}
+	if tr := body.Tracks[1]; tr.URI != "spotify:local:artist:album:song:180" || len(tr.Positions) != 1 || tr.Positions[0] != 4 {
+		t.Errorf("Unexpected removal %+v", tr)
+	}
+}
+
 func TestRemoveTracksFromPlaylistOpt(t *testing.T) {
 	client := testClientString(http.StatusOK, `{ "snapshot_id" : "JbtmHBDBAYu3/bt8BOXKjzKx3i0b6LCa/wVjyl6qQ2Yf6nFXkbmzuEa+ZI/U1yF+" }`)
 	addDummyAuth(client)
@@ -432,3 +668,259 @@ func TestReorderPlaylistRequest(t *testing.T) {
 		t.Error("Parameter snapshot_id shouldn't have been in body")
 	}
 }
+
+func TestPlaylistDuration(t *testing.T) {
+	tracks := make([]PlaylistTrack, 3)
+	tracks[0].Track.Duration = 60000
+	tracks[1].Track.Duration = 0 // unknown duration
+	tracks[2].Track.Duration = 90500
+	if d := PlaylistDuration(tracks); d != 150500*time.Millisecond {
+		t.Errorf("Wanted 2m30.5s, got %v\n", d)
+	}
+	if d := PlaylistDuration(nil); d != 0 {
+		t.Errorf("Wanted 0 for an empty playlist, got %v\n", d)
+	}
+}
+
+func playlistTracks(ids ...ID) []PlaylistTrack {
+	tracks := make([]PlaylistTrack, len(ids))
+	for i, id := range ids {
+		tracks[i].Track.ID = id
+		tracks[i].Track.URI = TrackURI(id)
+	}
+	return tracks
+}
+
+func TestDiffPlaylists(t *testing.T) {
+	// local files have a URI but no ID
+	withLocal := append(playlistTracks("a"), PlaylistTrack{})
+	withLocal[1].Track.URI = "spotify:local:Artist:Album:Title:180"
+
+	tests := []struct {
+		before, after  []PlaylistTrack
+		added, removed []URI
+		reordered      bool
+	}{
+		{playlistTracks("a", "b", "c"), playlistTracks("a", "b", "c"), nil, nil, false},
+		{playlistTracks("a", "b"), playlistTracks("a", "b", "c"), []URI{"spotify:track:c"}, nil, false},
+		{playlistTracks("a", "b", "c"), playlistTracks("a", "c"), nil, []URI{"spotify:track:b"}, false},
+		{playlistTracks("a", "b", "c"), playlistTracks("c", "a", "b"), nil, nil, true},
+		{playlistTracks("a", "b"), playlistTracks("b", "d", "a", "b"), []URI{"spotify:track:d", "spotify:track:b"}, nil, true},
+		{playlistTracks("a", "a", "b"), playlistTracks("b", "a"), nil, []URI{"spotify:track:a"}, true},
+		{nil, playlistTracks("a"), []URI{"spotify:track:a"}, nil, false},
+		{playlistTracks("a"), withLocal, []URI{"spotify:local:Artist:Album:Title:180"}, nil, false},
+		{withLocal, playlistTracks("a"), nil, []URI{"spotify:local:Artist:Album:Title:180"}, false},
+	}
+	for i, test := range tests {
+		added, removed, reordered := DiffPlaylists(test.before, test.after)
+		if fmt.Sprint(added) != fmt.Sprint(test.added) ||
+			fmt.Sprint(removed) != fmt.Sprint(test.removed) ||
+			reordered != test.reordered {
+			t.Errorf("Test %d: wanted (%v, %v, %v), got (%v, %v, %v)\n", i,
+				test.added, test.removed, test.reordered, added, removed, reordered)
+		}
+	}
+}
+
+func TestPlaylistOwnershipFields(t *testing.T) {
+	client := testClientString(http.StatusOK, `{
+		"id": "59ZbFPES4DQwEjBpWHzrtC",
+		"collaborative": true,
+		"public": false,
+		"snapshot_id": "bNLWdmhh+HDsbHzhckXeDC0uyKyg4FjPI/KEsKjAE526usnz2LxwgyBoMShVL+z+",
+		"owner": { "id": "wizzler", "display_name": "Ronald Pompa" }
+	}`)
+	p, err := client.GetPlaylist("wizzler", "59ZbFPES4DQwEjBpWHzrtC")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if p.Owner.ID != "wizzler" || p.Owner.DisplayName != "Ronald Pompa" {
+		t.Errorf("Unexpected owner: %+v\n", p.Owner)
+	}
+	if !p.Collaborative || p.IsPublic {
+		t.Error("Expected a private, collaborative playlist")
+	}
+	if p.SnapshotID != "bNLWdmhh+HDsbHzhckXeDC0uyKyg4FjPI/KEsKjAE526usnz2LxwgyBoMShVL+z+" {
+		t.Error("Unexpected snapshot ID:", p.SnapshotID)
+	}
+}
+
+func TestCurrentUsersPlaylistsCount(t *testing.T) {
+	client := testClientFile(http.StatusOK, "test_data/playlists_for_user.txt")
+	addDummyAuth(client)
+	n, err := client.CurrentUsersPlaylistsCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("Expected 3 playlists, got %d", n)
+	}
+	if u := getLastRequest(client).URL; u.Path != "/v1/me/playlists" || u.Query().Get("limit") != "1" {
+		t.Error("Expected request to /v1/me/playlists?limit=1, got", u)
+	}
+}
+
+func TestImageForWidth(t *testing.T) {
+	p := FullPlaylist{SimplePlaylist: SimplePlaylist{Images: []Image{
+		{Width: 640, URL: "large"},
+		{Width: 0, URL: "unknown"},
+		{Width: 60, URL: "small"},
+		{Width: 300, URL: "medium"},
+	}}}
+	tests := []struct {
+		px  int
+		url string
+	}{
+		{1, "small"},
+		{60, "small"},
+		{61, "medium"},
+		{300, "medium"},
+		{500, "large"},
+		{1000, "large"},
+	}
+	for _, tt := range tests {
+		if img := p.ImageForWidth(tt.px); img == nil || img.URL != tt.url {
+			t.Errorf("ImageForWidth(%d): expected %s, got %+v", tt.px, tt.url, img)
+		}
+	}
+
+	p.Images = p.Images[1:2]
+	if img := p.ImageForWidth(100); img == nil || img.URL != "unknown" {
+		t.Errorf("Expected the only image to be used, got %+v", img)
+	}
+	p.Images = nil
+	if img := p.ImageForWidth(100); img != nil {
+		t.Errorf("Expected nil for a playlist without images, got %+v", img)
+	}
+}
+
+func TestCurrentUsersEditablePlaylists(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{ "id": "me" }`},
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"items": [
+				{ "id": "mine", "owner": { "id": "me" } },
+				{ "id": "theirs", "owner": { "id": "bob" } }
+			],
+			"next": "https://api.spotify.com/v1/me/playlists?offset=2&limit=2"
+		}`},
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"items": [ { "id": "shared", "owner": { "id": "bob" }, "collaborative": true } ]
+		}`},
+	)
+	playlists, err := client.CurrentUsersEditablePlaylists(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(playlists) != 2 || playlists[0].ID != "mine" || playlists[1].ID != "shared" {
+		t.Errorf("Expected [mine shared], got %+v", playlists)
+	}
+	if l := rt.requests[1].URL.Query().Get("limit"); l != "50" {
+		t.Errorf("Expected a page size of 50, got %s", l)
+	}
+}
+
+func TestVerifyPlaylistSnapshot(t *testing.T) {
+	client, rt := testClientSequence(cannedResponse{statusCode: http.StatusOK, body: `{ "snapshot_id": "s2" }`})
+	ok, err := client.VerifyPlaylistSnapshot("abc", "s2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("Expected the snapshot to match")
+	}
+	if u := rt.requests[0].URL; u.Path != "/v1/playlists/abc" || u.Query().Get("fields") != "snapshot_id" {
+		t.Error("Unexpected request", u)
+	}
+	ok, err = client.VerifyPlaylistSnapshot("abc", "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("Expected an outdated snapshot not to match")
+	}
+}
+
+func TestPlaylistsFollowedBy(t *testing.T) {
+	rt := &followersRoundTripper{followed: map[string]bool{"p1": true, "p3": true}}
+	client := &Client{http: &http.Client{Transport: rt}}
+	follows, err := client.PlaylistsFollowedBy("bob", "p1", "p2", "p3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(follows) != 3 || !follows["p1"] || follows["p2"] || !follows["p3"] {
+		t.Errorf("Unexpected result: %v", follows)
+	}
+	for _, u := range rt.users {
+		if u != "bob" {
+			t.Errorf("Expected user bob to be checked, got %s", u)
+		}
+	}
+}
+
+// followersRoundTripper answers playlist followers/contains requests.
+type followersRoundTripper struct {
+	followed map[string]bool
+
+	mu    sync.Mutex
+	users []string
+}
+
+func (f *followersRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// /v1/playlists/{id}/followers/contains
+	parts := strings.Split(req.URL.Path, "/")
+	f.mu.Lock()
+	f.users = append(f.users, req.URL.Query().Get("ids"))
+	f.mu.Unlock()
+	body := fmt.Sprintf("[%v]", f.followed[parts[3]])
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func TestStreamCurrentUsersPlaylists(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"next": "https://api.spotify.com/v1/me/playlists?offset=2&limit=2",
+			"items": [ { "id": "a" }, { "id": "b" } ]
+		}`},
+		cannedResponse{statusCode: http.StatusOK, body: `{ "items": [ { "id": "c" } ] }`},
+	)
+	stream := client.StreamCurrentUsersPlaylists(context.Background())
+	var ids []ID
+	for p := range stream.Playlists {
+		ids = append(ids, p.ID)
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || ids[0] != "a" || ids[2] != "c" {
+		t.Errorf("Unexpected playlists %v", ids)
+	}
+	if len(rt.requests) != 2 {
+		t.Errorf("Expected 2 requests, got %d", len(rt.requests))
+	}
+}
+
+func TestStreamCurrentUsersPlaylistsError(t *testing.T) {
+	client, _ := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"next": "https://api.spotify.com/v1/me/playlists?offset=1&limit=1",
+			"items": [ { "id": "a" } ]
+		}`},
+		cannedResponse{statusCode: http.StatusNotFound, body: `{ "error": { "status": 404, "message": "Not found" } }`},
+	)
+	stream := client.StreamCurrentUsersPlaylists(context.Background())
+	n := 0
+	for range stream.Playlists {
+		n++
+	}
+	if n != 1 {
+		t.Errorf("Expected 1 playlist before the error, got %d", n)
+	}
+	if err, ok := stream.Err().(Error); !ok || err.Status != http.StatusNotFound {
+		t.Errorf("Expected a 404 Error, got %v", stream.Err())
+	}
+}
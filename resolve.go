@@ -0,0 +1,161 @@
+// Copyright 2014, 2015 Zac Bergquist
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spotify
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Link identifies a Spotify object referred to by a URI
+// (spotify:track:6rqhFgbbKwnb9MLmUQDhG6) or by a web link
+// (https://open.spotify.com/track/6rqhFgbbKwnb9MLmUQDhG6).
+type Link struct {
+	// Type is the kind of object: "track", "album", "artist",
+	// "playlist", or "user".
+	Type string
+	// ID is the Spotify ID of the object.  For users, it is the user ID.
+	ID ID
+	// Owner is the ID of the user who owns a playlist.  It is only set
+	// for the older user-scoped playlist links, such as
+	// spotify:user:spotify:playlist:37i9dQZF1DXcBWIGoYBM5M.
+	Owner string
+}
+
+// ErrInvalidLink is returned when a string can't be parsed as a
+// Spotify URI or web link.
+var ErrInvalidLink = errors.New("spotify: invalid Spotify URI or link")
+
+// ParseLink parses a Spotify URI or an open.spotify.com web link.
+// Query strings (like the ?si= share parameter) and locale path
+// prefixes (like /intl-de/) on web links are ignored.
+func ParseLink(s string) (Link, error) {
+	s = strings.TrimSpace(s)
+	var parts []string
+	if strings.HasPrefix(s, "spotify:") {
+		parts = strings.Split(strings.TrimPrefix(s, "spotify:"), ":")
+	} else {
+		u, err := url.Parse(s)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return Link{}, ErrInvalidLink
+		}
+		if u.Host != "open.spotify.com" && u.Host != "play.spotify.com" {
+			return Link{}, ErrInvalidLink
+		}
+		parts = strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) > 0 && strings.HasPrefix(parts[0], "intl-") {
+			parts = parts[1:]
+		}
+	}
+	for _, p := range parts {
+		if p == "" {
+			return Link{}, ErrInvalidLink
+		}
+	}
+
+	switch {
+	case len(parts) == 2:
+		switch parts[0] {
+		case "track", "album", "artist", "playlist", "user":
+			return Link{Type: parts[0], ID: ID(parts[1])}, nil
+		}
+	case len(parts) == 4 && parts[0] == "user" && parts[2] == "playlist":
+		return Link{Type: "playlist", ID: ID(parts[3]), Owner: parts[1]}, nil
+	}
+	return Link{}, ErrInvalidLink
+}
+
+// uriParts splits u into the type and ID of the object it refers to.
+func uriParts(u URI) (kind string, id ID, ok bool) {
+	parts := strings.Split(string(u), ":")
+	switch {
+	case len(parts) == 3 && parts[0] == "spotify":
+		kind, id = parts[1], ID(parts[2])
+	case len(parts) == 5 && parts[0] == "spotify" && parts[1] == "user" && parts[3] == "playlist":
+		kind, id = "playlist", ID(parts[4])
+	default:
+		return "", "", false
+	}
+	return kind, id, kind != "" && id != ""
+}
+
+// Type returns the type of object that u identifies, for example "track"
+// or "playlist".  It returns the empty string if u isn't a valid URI.
+func (u URI) Type() string {
+	kind, _, ok := uriParts(u)
+	if !ok {
+		return ""
+	}
+	return kind
+}
+
+// ID returns the ID of the object that u identifies.  It returns
+// ErrInvalidLink if u isn't a valid URI.
+func (u URI) ID() (ID, error) {
+	_, id, ok := uriParts(u)
+	if !ok {
+		return "", ErrInvalidLink
+	}
+	return id, nil
+}
+
+// Resolve parses a Spotify URI or web link and fetches the object
+// it refers to, using DefaultClient.
+func Resolve(link string) (interface{}, error) {
+	return DefaultClient.Resolve(link)
+}
+
+// Resolve parses a Spotify URI or web link and fetches the object
+// it refers to.  The result is one of *FullTrack, *FullAlbum,
+// *FullArtist, *FullPlaylist, or *User, depending on the kind of link.
+// If an error occurs, the result is nil.
+func (c *Client) Resolve(link string) (interface{}, error) {
+	l, err := ParseLink(link)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	switch l.Type {
+	case "track":
+		var t *FullTrack
+		t, err = c.GetTrack(l.ID)
+		result = t
+	case "album":
+		var a *FullAlbum
+		a, err = c.GetAlbum(l.ID)
+		result = a
+	case "artist":
+		var a *FullArtist
+		a, err = c.GetArtist(l.ID)
+		result = a
+	case "user":
+		var u *User
+		u, err = c.GetUsersPublicProfile(l.ID)
+		result = u
+	default: // "playlist"
+		var p *FullPlaylist
+		if l.Owner != "" {
+			p, err = c.GetPlaylist(l.Owner, l.ID)
+		} else {
+			p, err = c.getPlaylist(c.baseURL() + "playlists/" + string(l.ID))
+		}
+		result = p
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2014, 2015 Zac Bergquist
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spotify
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseLink(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Link
+	}{
+		{"spotify:track:6rqhFgbbKwnb9MLmUQDhG6", Link{Type: "track", ID: "6rqhFgbbKwnb9MLmUQDhG6"}},
+		{"spotify:user:spotify:playlist:37i9dQZF1DXcBWIGoYBM5M", Link{Type: "playlist", ID: "37i9dQZF1DXcBWIGoYBM5M", Owner: "spotify"}},
+		{"https://open.spotify.com/album/0sNOF9WDwhWunNAHPD3Baj?si=abc", Link{Type: "album", ID: "0sNOF9WDwhWunNAHPD3Baj"}},
+		{"https://open.spotify.com/intl-de/artist/0TnOYISbd1XYRBk9myaseg", Link{Type: "artist", ID: "0TnOYISbd1XYRBk9myaseg"}},
+		{"https://open.spotify.com/user/spotify/playlist/37i9dQZF1DXcBWIGoYBM5M", Link{Type: "playlist", ID: "37i9dQZF1DXcBWIGoYBM5M", Owner: "spotify"}},
+		{"https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M", Link{Type: "playlist", ID: "37i9dQZF1DXcBWIGoYBM5M"}},
+		{"https://open.spotify.com/user/wizzler", Link{Type: "user", ID: "wizzler"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseLink(tt.in)
+		if err != nil {
+			t.Errorf("ParseLink(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLink(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{
+		"",
+		"spotify:track:",
+		"spotify:episode:abc",
+		"https://example.com/track/6rqhFgbbKwnb9MLmUQDhG6",
+		"https://open.spotify.com/track",
+		"ftp://open.spotify.com/track/6rqhFgbbKwnb9MLmUQDhG6",
+	} {
+		if _, err := ParseLink(in); err != ErrInvalidLink {
+			t.Errorf("ParseLink(%q): got err %v, want ErrInvalidLink", in, err)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		link string
+		path string
+		body string
+	}{
+		{"spotify:track:abc", "/v1/tracks/abc", `{"id": "abc", "name": "t"}`},
+		{"https://open.spotify.com/album/abc", "/v1/albums/abc", `{"id": "abc", "name": "a"}`},
+		{"spotify:artist:abc", "/v1/artists/abc", `{"id": "abc", "name": "ar"}`},
+		{"spotify:user:bob", "/v1/users/bob", `{"id": "bob"}`},
+		{"spotify:user:bob:playlist:abc", "/v1/users/bob/playlists/abc", `{"id": "abc"}`},
+		{"https://open.spotify.com/playlist/abc", "/v1/playlists/abc", `{"id": "abc"}`},
+	}
+	for _, tt := range tests {
+		client, rt := testClientSequence(cannedResponse{statusCode: http.StatusOK, body: tt.body})
+		got, err := client.Resolve(tt.link)
+		if err != nil {
+			t.Errorf("Resolve(%q): %v", tt.link, err)
+			continue
+		}
+		if p := rt.requests[0].URL.Path; p != tt.path {
+			t.Errorf("Resolve(%q) requested %s, want %s", tt.link, p, tt.path)
+		}
+		var ok bool
+		switch l, _ := ParseLink(tt.link); l.Type {
+		case "track":
+			_, ok = got.(*FullTrack)
+		case "album":
+			_, ok = got.(*FullAlbum)
+		case "artist":
+			_, ok = got.(*FullArtist)
+		case "user":
+			_, ok = got.(*User)
+		case "playlist":
+			_, ok = got.(*FullPlaylist)
+		}
+		if !ok {
+			t.Errorf("Resolve(%q) returned %T", tt.link, got)
+		}
+	}
+}
+
+func TestResolveErrorIsNil(t *testing.T) {
+	for _, link := range []string{"spotify:track:abc", "spotify:user:bob", "https://open.spotify.com/playlist/abc"} {
+		client := testClientString(http.StatusNotFound, `{ "error": { "status": 404, "message": "non existing id" } }`)
+		got, err := client.Resolve(link)
+		if err == nil {
+			t.Errorf("Resolve(%q): expected an error", link)
+		}
+		if got != nil {
+			t.Errorf("Resolve(%q): expected a nil result on error, got %#v", link, got)
+		}
+	}
+}
+
+func TestURIParts(t *testing.T) {
+	tests := []struct {
+		uri  URI
+		kind string
+		id   ID
+	}{
+		{"spotify:track:6rqhFgbbKwnb9MLmUQDhG6", "track", "6rqhFgbbKwnb9MLmUQDhG6"},
+		{"spotify:episode:512ojhOuo1ktJprKbVcKyQ", "episode", "512ojhOuo1ktJprKbVcKyQ"},
+		{"spotify:user:spotify:playlist:37i9dQZF1DXcBWIGoYBM5M", "playlist", "37i9dQZF1DXcBWIGoYBM5M"},
+	}
+	for _, tt := range tests {
+		if kind := tt.uri.Type(); kind != tt.kind {
+			t.Errorf("%s: expected type %s, got %s", tt.uri, tt.kind, kind)
+		}
+		if id, err := tt.uri.ID(); err != nil || id != tt.id {
+			t.Errorf("%s: expected ID %s, got %s (%v)", tt.uri, tt.id, id, err)
+		}
+	}
+	for _, uri := range []URI{"", "spotify:track", "spotify:track:", "http:track:abc"} {
+		if kind := uri.Type(); kind != "" {
+			t.Errorf("%q: expected no type, got %s", uri, kind)
+		}
+		if _, err := uri.ID(); err != ErrInvalidLink {
+			t.Errorf("%q: expected ErrInvalidLink, got %v", uri, err)
+		}
+	}
+}
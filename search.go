@@ -15,7 +15,6 @@
 package spotify
 
 import (
-	"encoding/json"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -70,6 +69,36 @@ type SearchResult struct {
 	Tracks    *FullTrackPage      `json:"tracks"`
 }
 
+// TotalFor returns the total number of results available for the given
+// search type, across all pages.  If t contains several types, their totals
+// are added together.  Types that weren't searched for have no results.
+func (r *SearchResult) TotalFor(t SearchType) int {
+	total := 0
+	if t&SearchTypeAlbum != 0 && r.Albums != nil {
+		total += r.Albums.Total
+	}
+	if t&SearchTypeArtist != 0 && r.Artists != nil {
+		total += r.Artists.Total
+	}
+	if t&SearchTypePlaylist != 0 && r.Playlists != nil {
+		total += r.Playlists.Total
+	}
+	if t&SearchTypeTrack != 0 && r.Tracks != nil {
+		total += r.Tracks.Total
+	}
+	return total
+}
+
+// SearchOptions contains optional parameters that can be provided to
+// SearchWithOptions.  Only the non-nil (or non-zero) fields are used in queries.
+type SearchOptions struct {
+	Options
+	// IncludeExternal signals that the client can play externally hosted
+	// audio content, and marks the content as playable in the response.
+	// By default, externally hosted audio content is marked as unplayable.
+	IncludeExternal bool
+}
+
 // Search is a wrapper around DefaultClient.Search.
 func Search(query string, t SearchType) (*SearchResult, error) {
 	return DefaultClient.Search(query, t)
@@ -80,6 +109,11 @@ func SearchOpt(query string, t SearchType, opt *Options) (*SearchResult, error)
 	return DefaultClient.SearchOpt(query, t, opt)
 }
 
+// SearchWithOptions is a wrapper around DefaultClient.SearchWithOptions.
+func SearchWithOptions(query string, t SearchType, opt *SearchOptions) (*SearchResult, error) {
+	return DefaultClient.SearchWithOptions(query, t, opt)
+}
+
 // Search gets Spotify catalog information about artists, albums, tracks,
 // or playlists that match a keyword string.  t is a mask containing one or more
 // search types.  For example, `Search(query, SearchTypeArtist|SearchTypeAlbum)`
@@ -142,6 +176,17 @@ func (c *Client) Search(query string, t SearchType) (*SearchResult, error) {
 // If the client has a valid access token, then the results will only include
 // content playable in the user's country.
 func (c *Client) SearchOpt(query string, t SearchType, opt *Options) (*SearchResult, error) {
+	if opt == nil {
+		return c.SearchWithOptions(query, t, nil)
+	}
+	return c.SearchWithOptions(query, t, &SearchOptions{Options: *opt})
+}
+
+// SearchWithOptions is like SearchOpt, but it accepts the search-only
+// parameters in SearchOptions as well.  Set the IncludeExternal option if
+// your client can play externally hosted audio content (such as podcasts
+// hosted outside of Spotify).
+func (c *Client) SearchWithOptions(query string, t SearchType, opt *SearchOptions) (*SearchResult, error) {
 	query = url.QueryEscape(query)
 	v := url.Values{}
 	v.Set("q", query)
@@ -156,20 +201,23 @@ func (c *Client) SearchOpt(query string, t SearchType, opt *Options) (*SearchRes
 		if opt.Offset != nil {
 			v.Set("offset", strconv.Itoa(*opt.Offset))
 		}
+		if opt.IncludeExternal {
+			v.Set("include_external", "audio")
+		}
 	}
-	spotifyURL := baseAddress + "search?" + v.Encode()
-	resp, err := c.http.Get(spotifyURL)
+	spotifyURL := c.baseURL() + "search?" + v.Encode()
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 
 	var result SearchResult
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	err = c.decode(resp.Body, &result)
 	if err != nil {
 		return nil, err
 	}
@@ -239,3 +287,52 @@ func (c *Client) NextTrackResults(s *SearchResult) error {
 	}
 	return c.getPage(s.Tracks.Next, s)
 }
+
+// SearchNextTracks gets the next page of track results after prev.  Unlike
+// NextTrackResults, it doesn't modify prev: it returns a new SearchResult
+// that only contains the tracks, so each category can be paged through
+// independently.  It returns ErrNoMorePages if there are no more tracks.
+func (c *Client) SearchNextTracks(prev *SearchResult) (*SearchResult, error) {
+	if prev.Tracks == nil {
+		return nil, ErrNoMorePages
+	}
+	return c.searchNext(prev.Tracks.Next)
+}
+
+// SearchNextAlbums is like SearchNextTracks, but for album results.
+func (c *Client) SearchNextAlbums(prev *SearchResult) (*SearchResult, error) {
+	if prev.Albums == nil {
+		return nil, ErrNoMorePages
+	}
+	return c.searchNext(prev.Albums.Next)
+}
+
+// SearchNextArtists is like SearchNextTracks, but for artist results.
+func (c *Client) SearchNextArtists(prev *SearchResult) (*SearchResult, error) {
+	if prev.Artists == nil {
+		return nil, ErrNoMorePages
+	}
+	return c.searchNext(prev.Artists.Next)
+}
+
+// SearchNextPlaylists is like SearchNextTracks, but for playlist results.
+func (c *Client) SearchNextPlaylists(prev *SearchResult) (*SearchResult, error) {
+	if prev.Playlists == nil {
+		return nil, ErrNoMorePages
+	}
+	return c.searchNext(prev.Playlists.Next)
+}
+
+// searchNext fetches the search results at next, which is the Next link of
+// one of the categories in a previous result.  The Web API only returns
+// the category the link belongs to.
+func (c *Client) searchNext(next string) (*SearchResult, error) {
+	if next == "" {
+		return nil, ErrNoMorePages
+	}
+	var result SearchResult
+	if err := c.getPage(next, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
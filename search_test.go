@@ -86,6 +86,52 @@ func TestSearchPlaylistTrack(t *testing.T) {
 	}
 }
 
+func TestSearchTotalFor(t *testing.T) {
+	client := testClientFile(http.StatusOK, "test_data/search_trackplaylist.txt")
+	result, err := client.Search("holiday", SearchTypePlaylist|SearchTypeTrack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlists, tracks := result.TotalFor(SearchTypePlaylist), result.TotalFor(SearchTypeTrack)
+	if playlists != result.Playlists.Total || tracks != result.Tracks.Total || playlists == 0 || tracks == 0 {
+		t.Errorf("Unexpected totals: %d playlists, %d tracks", playlists, tracks)
+	}
+	if both := result.TotalFor(SearchTypePlaylist | SearchTypeTrack); both != playlists+tracks {
+		t.Errorf("Expected %d results in total, got %d", playlists+tracks, both)
+	}
+	if n := result.TotalFor(SearchTypeAlbum); n != 0 {
+		t.Errorf("Expected no album results, got %d", n)
+	}
+}
+
+func TestSearchIncludeExternal(t *testing.T) {
+	client := testClientFile(http.StatusOK, "test_data/search_tracks.txt")
+	_, err := client.SearchWithOptions("uptown", SearchTypeTrack, &SearchOptions{IncludeExternal: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	req := getLastRequest(client)
+	if v := req.URL.Query().Get("include_external"); v != "audio" {
+		t.Errorf("Wanted include_external=audio, got '%s'\n", v)
+	}
+}
+
+func TestSearchOptMarket(t *testing.T) {
+	client := testClientFile(http.StatusOK, "test_data/search_tracks.txt")
+	country := "SE"
+	if _, err := client.SearchOpt("uptown", SearchTypeTrack, &Options{Country: &country}); err != nil {
+		t.Fatal(err)
+	}
+	q := getLastRequest(client).URL.Query()
+	if m := q.Get("market"); m != "SE" {
+		t.Errorf("Wanted market=SE, got '%s'", m)
+	}
+	if v := q.Get("include_external"); v != "" {
+		t.Errorf("Didn't expect include_external, got '%s'", v)
+	}
+}
+
 func TestPrevNextSearchPageErrors(t *testing.T) {
 	// we expect to get ErrNoMorePages when trying to get the prev/next page
 	// under either of these conditions:
@@ -150,3 +196,33 @@ func TestSearchAgainstAPI(t *testing.T) {
 		t.Error("Failed to get previous page")
 	}
 }
+
+func TestSearchNextTracks(t *testing.T) {
+	client, rt := testClientSequence(cannedResponse{statusCode: http.StatusOK, body: `{
+		"tracks": { "items": [ { "name": "Next" } ], "offset": 20, "previous": "https://api.spotify.com/v1/search?offset=0" }
+	}`})
+	prev := &SearchResult{
+		Albums: &SimpleAlbumPage{PageBase: PageBase{Next: "https://api.spotify.com/v1/search?type=album&offset=20"}},
+		Tracks: &FullTrackPage{PageBase: PageBase{Next: "https://api.spotify.com/v1/search?type=track&offset=20"}},
+	}
+	next, err := client.SearchNextTracks(prev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q := rt.requests[0].URL.Query().Get("type"); q != "track" {
+		t.Errorf("Expected the tracks' next link to be followed, got type=%s", q)
+	}
+	if next.Albums != nil || next.Tracks == nil || next.Tracks.Tracks[0].Name != "Next" {
+		t.Errorf("Expected only tracks in the result, got %+v", next)
+	}
+	if prev.Tracks.Offset != 0 {
+		t.Error("Expected the previous result to be unchanged")
+	}
+
+	if _, err := client.SearchNextArtists(prev); err != ErrNoMorePages {
+		t.Errorf("Expected ErrNoMorePages for missing artists, got %v", err)
+	}
+	if _, err := client.SearchNextPlaylists(&SearchResult{Playlists: new(SimplePlaylistPage)}); err != ErrNoMorePages {
+		t.Errorf("Expected ErrNoMorePages for the last page, got %v", err)
+	}
+}
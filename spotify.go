@@ -17,12 +17,18 @@
 package spotify
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 const (
@@ -44,7 +50,8 @@ var (
 	// that don't require authorization.  If you need to authenticate, create
 	// your own client with `Authenticator.NewClient`.
 	DefaultClient = &Client{
-		http: new(http.Client),
+		http:    new(http.Client),
+		country: new(countryCache),
 	}
 )
 
@@ -52,6 +59,42 @@ var (
 // spotify:track:6rqhFgbbKwnb9MLmUQDhG6
 type URI string
 
+// URIFor builds the Spotify URI for an object of the specified kind
+// (for example "track", "album", or "playlist") with the given ID.
+func URIFor(kind string, id ID) URI {
+	return URI("spotify:" + kind + ":" + string(id))
+}
+
+// TrackURI returns the Spotify URI for the track with the specified ID.
+func TrackURI(id ID) URI {
+	return URIFor("track", id)
+}
+
+// AlbumURI returns the Spotify URI for the album with the specified ID.
+func AlbumURI(id ID) URI {
+	return URIFor("album", id)
+}
+
+// ArtistURI returns the Spotify URI for the artist with the specified ID.
+func ArtistURI(id ID) URI {
+	return URIFor("artist", id)
+}
+
+// PlaylistURI returns the Spotify URI for the playlist with the specified ID.
+func PlaylistURI(id ID) URI {
+	return URIFor("playlist", id)
+}
+
+// ShowURI returns the Spotify URI for the show with the specified ID.
+func ShowURI(id ID) URI {
+	return URIFor("show", id)
+}
+
+// EpisodeURI returns the Spotify URI for the episode with the specified ID.
+func EpisodeURI(id ID) URI {
+	return URIFor("episode", id)
+}
+
 // ID is a base-62 identifier for an artist, track, album, etc.
 // It can be found at the end of a spotify.URI.
 type ID string
@@ -60,13 +103,29 @@ func (id *ID) String() string {
 	return string(*id)
 }
 
+// Valid reports whether id looks like a Spotify ID: 22 base-62 characters.
+// It doesn't check that the ID refers to an existing object.  Note that
+// user IDs don't follow this format.
+func (id ID) Valid() bool {
+	if len(id) != 22 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
 // Followers contains information about the number of people following a
-// particular artist or playlist.
+// particular artist, playlist or user.  The same type is used for all three.
 type Followers struct {
 	// The total number of followers.
 	Count uint `json:"total"`
 	// A link to the Web API endpoint providing full details of the followers,
-	// or the empty string if this data is not available.
+	// or the empty string if this data is not available.  Spotify currently
+	// never provides it.
 	Endpoint string `json:"href"`
 }
 
@@ -98,6 +157,33 @@ func (i Image) Download(dst io.Writer) error {
 	return nil
 }
 
+// imageForWidth returns the narrowest image that is at least px pixels
+// wide.  If every image is narrower, the widest one is returned.  Images
+// whose width is unknown (zero) are only used if no other image is
+// available.  It returns nil if images is empty.
+func imageForWidth(images []Image, px int) *Image {
+	var best *Image
+	for i := range images {
+		img := &images[i]
+		switch {
+		case best == nil:
+			best = img
+		case best.Width == 0:
+			if img.Width != 0 {
+				best = img
+			}
+		case img.Width == 0:
+		case best.Width < px:
+			if img.Width > best.Width {
+				best = img
+			}
+		case img.Width >= px && img.Width < best.Width:
+			best = img
+		}
+	}
+	return best
+}
+
 // Error represents an error returned by the Spotify Web API.
 type Error struct {
 	// A short description of the error.
@@ -110,18 +196,136 @@ func (e Error) Error() string {
 	return e.Message
 }
 
-// decodeError decodes an Error from an io.Reader.
-func decodeError(r io.Reader) error {
+// DeprecatedEndpointError is returned when Spotify refuses a request to an
+// endpoint that it has deprecated.  In November 2024 Spotify stopped serving
+// several endpoints (including related artists, featured playlists and
+// category playlists) to applications that weren't already using them.
+// Those applications get an HTTP 403 instead.  Other errors from these
+// endpoints, such as a 404 for an ID that doesn't exist, are returned as an
+// Error.  A DeprecatedEndpointError wraps the Error returned by the Web API,
+// so errors.As can be used to get at it.
+type DeprecatedEndpointError struct {
+	// Method is the name of the Client method that was called.
+	Method string
+	// Err is the error returned by the Web API.
+	Err Error
+}
+
+func (e DeprecatedEndpointError) Error() string {
+	return "spotify: " + e.Method + " uses an endpoint that Spotify has deprecated" +
+		" and may not be available to your application (" + e.Err.Message + ")"
+}
+
+// Unwrap returns the error returned by the Web API.
+func (e DeprecatedEndpointError) Unwrap() error {
+	return e.Err
+}
+
+// deprecated converts err to a DeprecatedEndpointError if it indicates that
+// the endpoint behind method is no longer available.  Other errors are
+// returned unchanged.
+func deprecated(method string, err error) error {
+	if e, ok := err.(Error); ok && e.Status == http.StatusForbidden {
+		return DeprecatedEndpointError{Method: method, Err: e}
+	}
+	return err
+}
+
+// TooManyIDsError is returned when a call is given more IDs than the Web
+// API accepts in a single request.  No request is sent.
+type TooManyIDsError struct {
+	// Method is the name of the Client method that was called.
+	Method string
+	// Max is the maximum number of IDs the call accepts.
+	Max int
+	// Count is the number of IDs that were given.
+	Count int
+}
+
+func (e TooManyIDsError) Error() string {
+	return "spotify: " + e.Method + " supports at most " + strconv.Itoa(e.Max) +
+		" IDs per call, got " + strconv.Itoa(e.Count)
+}
+
+// checkIDs returns a TooManyIDsError if there are more than max ids.
+func checkIDs(method string, max int, ids []ID) error {
+	if len(ids) > max {
+		return TooManyIDsError{Method: method, Max: max, Count: len(ids)}
+	}
+	return nil
+}
+
+// InsufficientScopeError is returned when Spotify refuses a request because
+// the access token wasn't granted a scope that the request needs.  The user
+// can be asked to authorize the application again with the missing scopes.
+//
+// These errors used to be returned as a plain Error.  An InsufficientScopeError
+// wraps that Error, so code that checked for it should use errors.As instead
+// of a type assertion.
+type InsufficientScopeError struct {
+	// Required lists the scopes the request needs, one of which is usually
+	// missing.  It is empty if the scopes couldn't be determined from the
+	// request.
+	Required []string
+	// Err is the error returned by the Web API.
+	Err Error
+}
+
+func (e InsufficientScopeError) Error() string {
+	msg := "spotify: insufficient scope (" + e.Err.Message + ")"
+	if len(e.Required) > 0 {
+		msg += "; requires " + strings.Join(e.Required, " or ")
+	}
+	return msg
+}
+
+// Unwrap returns the error returned by the Web API.
+func (e InsufficientScopeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeError decodes an Error from the body of resp.  Errors caused by a
+// missing scope are returned as an InsufficientScopeError.
+func decodeError(resp *http.Response) error {
 	var e struct {
 		E Error `json:"error"`
 	}
-	err := json.NewDecoder(r).Decode(&e)
+	err := json.NewDecoder(resp.Body).Decode(&e)
 	if err != nil {
 		return errors.New("spotify: couldn't decode error")
 	}
+	if e.E.Status == http.StatusForbidden && strings.Contains(strings.ToLower(e.E.Message), "scope") {
+		var required []string
+		if req := resp.Request; req != nil {
+			required = requiredScopes(req.Method, req.URL.Path)
+		}
+		return InsufficientScopeError{Required: required, Err: e.E}
+	}
 	return e.E
 }
 
+// ErrUnexpectedResultCount is returned by calls that check several items at
+// once (such as UserHasTracks) when Spotify doesn't return exactly one result
+// per item.  The accompanying result is still aligned with the items that were
+// checked: missing values are reported as false, and extra values are dropped.
+var ErrUnexpectedResultCount = errors.New("spotify: unexpected number of results")
+
+// decodeContains decodes the response of a "contains" endpoint, which
+// should hold one bool for each of the n items that were checked.
+func (c *Client) decodeContains(r io.Reader, n int) ([]bool, error) {
+	var result []bool
+	err := c.decode(r, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) != n {
+		aligned := make([]bool, n)
+		copy(aligned, result)
+		return aligned, ErrUnexpectedResultCount
+	}
+	return result, nil
+}
+
 // ExternalID contains information that identifies an item.
 type ExternalID struct {
 	// The identifier type, for example:
@@ -142,12 +346,436 @@ type ExternalURL struct {
 	Value string `json:"{value}"`
 }
 
+// The Web API represents external IDs and URLs as objects keyed by type,
+// for example {"isrc": "USRC16901355"}.  unmarshalKeyValue extracts one
+// key and value from such an object.  If the object has more than one
+// entry, the first key in priority that is present is used; failing that,
+// the entry with the lexically smallest key is used, so that the result
+// doesn't depend on map iteration order.
+func unmarshalKeyValue(data []byte, priority ...string) (key, value string, err error) {
+	var m map[string]string
+	if err := json.Unmarshal(data, &m); err != nil {
+		return "", "", err
+	}
+	for _, k := range priority {
+		if v, ok := m[k]; ok {
+			return k, v, nil
+		}
+	}
+	for k, v := range m {
+		if key == "" || k < key {
+			key, value = k, v
+		}
+	}
+	return key, value, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// When an item has several external IDs, only one is kept: an ISRC if
+// there is one, then an EAN, then a UPC.
+func (e *ExternalID) UnmarshalJSON(data []byte) error {
+	var err error
+	e.Key, e.Value, err = unmarshalKeyValue(data, "isrc", "ean", "upc")
+	return err
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e ExternalID) MarshalJSON() ([]byte, error) {
+	if e.Key == "" {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]string{e.Key: e.Value})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// When an item has several external URLs, the Spotify URL is kept.
+func (e *ExternalURL) UnmarshalJSON(data []byte) error {
+	var err error
+	e.Key, e.Value, err = unmarshalKeyValue(data, "spotify")
+	return err
+}
+
+// MarshalJSON implements json.Marshaler.
+func (e ExternalURL) MarshalJSON() ([]byte, error) {
+	if e.Key == "" {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(map[string]string{e.Key: e.Value})
+}
+
 // Client is a client for working with the Spotify Web API.
 // To create an authenticated client, use the
 // `Authenticator.NewClient` method.  If you don't need to
-// authenticate, you can use `DefaultClient`.
+// authenticate, you can use `DefaultClient`.  The zero value
+// is an unauthenticated client that is ready to use.
+//
+// Responses are requested gzip-compressed and decompressed transparently
+// by the net/http Transport.  The client never sets Accept-Encoding
+// itself, because doing so would turn that handling off.
 type Client struct {
-	http *http.Client
+	http      *http.Client
+	limiter   *limiter
+	userAgent string
+
+	country *countryCache // nil if the client doesn't cache it
+
+	// BaseURL is the address of the Web API that requests are sent to, for
+	// example "https://api.spotify.com/v1/".  It must include a trailing
+	// slash.  If empty, the Spotify Web API is used.  Setting BaseURL is
+	// mostly useful for testing against a fake server such as the one in
+	// the spotifytest package.
+	BaseURL string
+
+	// StrictDecoding causes the client to return an error when a response
+	// contains JSON fields that aren't modeled by this package.  Spotify
+	// adds new fields on a regular basis, so this is off by default, but
+	// it can be useful during development to spot missing data.
+	StrictDecoding bool
+
+	// AutoRetry causes the client to retry requests that fail for transient
+	// reasons.  Requests that are rate limited (HTTP 429) are retried after
+	// the delay requested by Spotify.  GET requests that fail with a 500,
+	// 502, 503 or 504 are retried with jittered exponential backoff.
+	AutoRetry bool
+	// MaxRetries is the maximum number of times a request is retried when
+	// AutoRetry is set.  If zero, DefaultMaxRetries is used.
+	MaxRetries int
+	// RetryNonIdempotent allows POST, PUT and DELETE requests to be retried
+	// on server errors as well.  Only set this if you're sure that repeating
+	// a modification won't have unwanted side effects.
+	RetryNonIdempotent bool
+
+	// Timeout limits how long a call to the Web API can take, including
+	// any retries, when the request's context has no deadline of its own.
+	// The time spent reading the response body counts towards it.  If
+	// zero, requests without a deadline can take as long as the
+	// underlying http.Client allows.
+	Timeout time.Duration
+
+	// RelinkCache, if set, records which track Spotify substitutes for
+	// each track that the client fetches for a specific market.
+	RelinkCache *RelinkCache
+}
+
+// defaultUserAgent identifies requests from clients that haven't called
+// SetUserAgent.
+const defaultUserAgent = "go-spotify"
+
+// SetUserAgent sets the User-Agent header that is sent with every request
+// to the Web API.  Identifying your application makes it easier for Spotify
+// (and you) to tell its traffic apart, for example in proxy logs.  If
+// ua is empty, the default ("go-spotify") is used.
+func (c *Client) SetUserAgent(ua string) {
+	c.userAgent = ua
+}
+
+// DefaultMaxRetries is the number of times a request is retried when
+// Client.AutoRetry is set and Client.MaxRetries is zero.
+const DefaultMaxRetries = 3
+
+var (
+	// retryBaseDelay is the delay before the first retry of a request that
+	// failed with a server error.  It doubles with every subsequent attempt,
+	// up to retryMaxDelay.
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 30 * time.Second
+)
+
+// baseURL returns the address of the Web API, including the trailing slash.
+func (c *Client) baseURL() string {
+	if c.BaseURL != "" {
+		return c.BaseURL
+	}
+	return baseAddress
+}
+
+// httpClient returns the HTTP client used to send requests.  The zero
+// Client uses http.DefaultClient.
+func (c *Client) httpClient() *http.Client {
+	if c.http != nil {
+		return c.http
+	}
+	return http.DefaultClient
+}
+
+// decode unmarshals the JSON in r into v, honoring c.StrictDecoding.
+func (c *Client) decode(r io.Reader, v interface{}) error {
+	d := json.NewDecoder(r)
+	if c.StrictDecoding {
+		d.DisallowUnknownFields()
+	}
+	return d.Decode(v)
+}
+
+// get issues a GET request to the specified URL.  See Client.do.
+func (c *Client) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+// resolveURL returns path relative to the client's base URL, or path
+// itself if it's already an absolute URL.
+func (c *Client) resolveURL(path string) string {
+	if strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://") {
+		return path
+	}
+	return c.baseURL() + strings.TrimPrefix(path, "/")
+}
+
+// GetRaw sends a GET request to the Web API and returns the response body
+// exactly as Spotify sent it.  This is mostly useful for debugging, for
+// example to compare a decoded result against the JSON it came from.
+// The path is relative to the client's base URL (for example
+// "tracks/6rqhFgbbKwnb9MLmUQDhG6?market=US"), but absolute URLs such
+// as the Next link of a page are used as is.
+func (c *Client) GetRaw(ctx context.Context, path string) (json.RawMessage, error) {
+	req, err := http.NewRequest("GET", c.resolveURL(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeError(resp)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(body), nil
+}
+
+// do sends an HTTP request, retrying it as configured by c.AutoRetry.
+// A request with a body is only retried if the body can be recreated with
+// req.GetBody, which http.NewRequest sets up for *bytes.Reader and
+// *strings.Reader bodies.  Always build request bodies from one of those
+// (rather than an arbitrary io.Reader) so that they can be replayed.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.Timeout <= 0 {
+		return c.doRetries(req)
+	}
+	if _, ok := req.Context().Deadline(); ok {
+		return c.doRetries(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), c.Timeout)
+	resp, err := c.doRetries(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// the deadline must outlive do, since the caller still
+	// has to read the body
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: cancel}
+	return resp, nil
+}
+
+// doRetries sends req, retrying it as configured by c.
+func (c *Client) doRetries(req *http.Request) (*http.Response, error) {
+	maxRetries := c.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultMaxRetries
+	}
+	if req.Header.Get("User-Agent") == "" {
+		ua := c.userAgent
+		if ua == "" {
+			ua = defaultUserAgent
+		}
+		req.Header.Set("User-Agent", ua)
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(req, attempt)
+		if err == nil && resp.Request == nil {
+			// decodeError uses the request to work out missing scopes
+			resp.Request = req
+		}
+		if err != nil || !c.AutoRetry || attempt >= maxRetries {
+			return resp, err
+		}
+		delay, ok := c.retryDelay(req, resp, attempt)
+		if !ok {
+			return resp, nil
+		}
+		if req.Body != nil {
+			// the previous attempt consumed the body, so we can
+			// only retry if it can be recreated
+			if req.GetBody == nil {
+				return resp, nil
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return resp, nil
+			}
+			req.Body = body
+		}
+		resp.Body.Close()
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// send sends a single HTTP request, honoring the limits set with
+// SetMaxConcurrency.
+func (c *Client) send(req *http.Request, attempt int) (*http.Response, error) {
+	l := c.limiter
+	if l == nil {
+		return c.httpClient().Do(req)
+	}
+	if err := l.acquire(req.Context()); err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		l.release()
+		return resp, err
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		l.pause(retryAfter(resp, attempt))
+	}
+	// the request stays in flight until its body has been consumed
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: l.release}
+	return resp, nil
+}
+
+// SetMaxConcurrency limits the number of requests that c has in flight
+// at any one time to n.  Requests made while the limit is reached block
+// until an earlier request completes, which happens when its response
+// body has been closed.  While a limit is set, a rate limited (HTTP 429)
+// response also pauses all of the client's requests for the delay
+// requested by Spotify, so that goroutines sharing the client back off
+// together.
+//
+// A value of n less than 1 removes the limit.  SetMaxConcurrency must not
+// be called while requests are in progress.
+func (c *Client) SetMaxConcurrency(n int) {
+	if n < 1 {
+		c.limiter = nil
+		return
+	}
+	c.limiter = &limiter{sem: make(chan struct{}, n)}
+}
+
+// limiter bounds the number of concurrent requests and coordinates
+// rate limiting across them.
+type limiter struct {
+	sem chan struct{}
+
+	mu          sync.Mutex
+	pausedUntil time.Time
+}
+
+// acquire blocks until a request may be sent, or until ctx is done, in
+// which case it returns ctx's error.
+func (l *limiter) acquire(ctx context.Context) error {
+	select {
+	case l.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	for {
+		l.mu.Lock()
+		d := l.pausedUntil.Sub(time.Now())
+		l.mu.Unlock()
+		if d <= 0 {
+			return nil
+		}
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			l.release()
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *limiter) release() {
+	<-l.sem
+}
+
+// pause holds back all requests for at least d.
+func (l *limiter) pause(d time.Duration) {
+	until := time.Now().Add(d)
+	l.mu.Lock()
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+	l.mu.Unlock()
+}
+
+// releaseOnClose calls release the first time it is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (r *releaseOnClose) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.release)
+	return err
+}
+
+// retryDelay determines whether a request that resulted in resp should be
+// retried, and if so, how long to wait before doing so.
+func (c *Client) retryDelay(req *http.Request, resp *http.Response, attempt int) (time.Duration, bool) {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		// rate limited requests were never processed, so
+		// they're safe to retry regardless of the method
+		return retryAfter(resp, attempt), true
+	case http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		if req.Method != "GET" && !c.RetryNonIdempotent {
+			return 0, false
+		}
+		return backoff(attempt), true
+	}
+	return 0, false
+}
+
+// retryAfter returns the delay requested by the Retry-After header of a
+// rate limited response, falling back to backoff if there isn't one.  The
+// header can hold either a number of seconds or an HTTP date.  A date is
+// measured from the response's Date header, so that a skewed local clock
+// doesn't change the delay, or from the current time if there is no Date.
+func retryAfter(resp *http.Response, attempt int) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		now := time.Now()
+		if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+			now = date
+		}
+		if d := when.Sub(now); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return backoff(attempt)
+}
+
+// backoff returns a randomized delay that grows exponentially with attempt.
+func backoff(attempt int) time.Duration {
+	d := retryMaxDelay
+	if attempt < 16 {
+		if exp := retryBaseDelay << uint(attempt); exp < d {
+			d = exp
+		}
+	}
+	// use "equal jitter" so that concurrent clients spread out their
+	// retries, while still waiting at least half of the computed delay
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1))
 }
 
 // Options contains optional parameters that can be provided
@@ -169,7 +797,7 @@ type Options struct {
 // NewReleasesOpt is like NewReleases, but it accepts optional parameters
 // for filtering the results.
 func (c *Client) NewReleasesOpt(opt *Options) (albums *SimpleAlbumPage, err error) {
-	spotifyURL := baseAddress + "browse/new-releases"
+	spotifyURL := c.baseURL() + "browse/new-releases"
 	if opt != nil {
 		v := url.Values{}
 		if opt.Country != nil {
@@ -185,16 +813,16 @@ func (c *Client) NewReleasesOpt(opt *Options) (albums *SimpleAlbumPage, err erro
 			spotifyURL += "?" + params
 		}
 	}
-	resp, err := c.http.Get(spotifyURL)
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var result SimpleAlbumPage
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	err = c.decode(resp.Body, &result)
 	if err != nil {
 		return nil, err
 	}
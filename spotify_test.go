@@ -15,11 +15,18 @@
 package spotify
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type stringRoundTripper struct {
@@ -126,3 +133,591 @@ func TestNewReleases(t *testing.T) {
 		return
 	}
 }
+
+func TestURIBuilders(t *testing.T) {
+	tests := []struct {
+		got  URI
+		want URI
+	}{
+		{TrackURI("6rqhFgbbKwnb9MLmUQDhG6"), "spotify:track:6rqhFgbbKwnb9MLmUQDhG6"},
+		{AlbumURI("0sNOF9WDwhWunNAHPD3Baj"), "spotify:album:0sNOF9WDwhWunNAHPD3Baj"},
+		{ArtistURI("0TnOYISbd1XYRBk9myaseg"), "spotify:artist:0TnOYISbd1XYRBk9myaseg"},
+		{PlaylistURI("59ZbFPES4DQwEjBpWHzrtC"), "spotify:playlist:59ZbFPES4DQwEjBpWHzrtC"},
+		{ShowURI("38bS44xjbVVZ3No3ByF1dJ"), "spotify:show:38bS44xjbVVZ3No3ByF1dJ"},
+		{EpisodeURI("512ojhOuo1ktJprKbVcKyQ"), "spotify:episode:512ojhOuo1ktJprKbVcKyQ"},
+		{URIFor("user", "wizzler"), "spotify:user:wizzler"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("Wanted %s, got %s\n", test.want, test.got)
+		}
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	body := `{ "id": "abc", "name": "A Track", "some_new_field": 42 }`
+
+	client := testClientString(http.StatusOK, body)
+	track, err := client.GetTrack("abc")
+	if err != nil {
+		t.Error("Unknown fields should be ignored by default:", err)
+		return
+	}
+	if track.Name != "A Track" {
+		t.Errorf("Wanted 'A Track', got '%s'\n", track.Name)
+	}
+
+	client = testClientString(http.StatusOK, body)
+	client.StrictDecoding = true
+	_, err = client.GetTrack("abc")
+	if err == nil {
+		t.Error("Expected an error for unknown field with StrictDecoding")
+	}
+}
+
+type cannedResponse struct {
+	statusCode int
+	header     http.Header
+	body       string
+}
+
+// sequenceRoundTripper answers each request with the next response in
+// its list.  Once the list is exhausted, the last response is repeated.
+type sequenceRoundTripper struct {
+	responses []cannedResponse
+	requests  []*http.Request
+	bodies    []string
+}
+
+func (s *sequenceRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := ""
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		body = string(b)
+	}
+	s.requests = append(s.requests, req)
+	s.bodies = append(s.bodies, body)
+	i := len(s.requests) - 1
+	if i >= len(s.responses) {
+		i = len(s.responses) - 1
+	}
+	r := s.responses[i]
+	header := r.header
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		StatusCode: r.statusCode,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(r.body)),
+	}, nil
+}
+
+// Returns a client that answers requests with the specified responses,
+// in order, along with the round tripper so that requests can be inspected.
+func testClientSequence(responses ...cannedResponse) (*Client, *sequenceRoundTripper) {
+	rt := &sequenceRoundTripper{responses: responses}
+	return &Client{
+		http: &http.Client{
+			Transport: rt,
+		},
+	}, rt
+}
+
+// fastRetries shortens the retry backoff.  It returns a function
+// that restores the original value.
+func fastRetries() func() {
+	old := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	return func() { retryBaseDelay = old }
+}
+
+const serverError = `{ "error": { "status": 503, "message": "Service unavailable" } }`
+
+func TestRetryServerError(t *testing.T) {
+	defer fastRetries()()
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusServiceUnavailable, body: serverError},
+		cannedResponse{statusCode: http.StatusBadGateway, body: serverError},
+		cannedResponse{statusCode: http.StatusOK, body: `{ "name": "Timber" }`},
+	)
+	client.AutoRetry = true
+	track, err := client.GetTrack("1zHlj4dQ8ZAtrayhuDDmkY")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if track.Name != "Timber" {
+		t.Errorf("Wanted track Timber, got %s\n", track.Name)
+	}
+	if l := len(rt.requests); l != 3 {
+		t.Errorf("Expected 3 requests, got %d\n", l)
+	}
+}
+
+func TestRetryDisabledByDefault(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusServiceUnavailable, body: serverError},
+		cannedResponse{statusCode: http.StatusOK, body: `{ "name": "Timber" }`},
+	)
+	_, err := client.GetTrack("1zHlj4dQ8ZAtrayhuDDmkY")
+	if err == nil {
+		t.Error("Expected an error")
+	}
+	if l := len(rt.requests); l != 1 {
+		t.Errorf("Expected 1 request, got %d\n", l)
+	}
+}
+
+func TestRetryRespectsMaxRetries(t *testing.T) {
+	defer fastRetries()()
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusInternalServerError, body: serverError},
+	)
+	client.AutoRetry = true
+	client.MaxRetries = 2
+	_, err := client.GetTrack("1zHlj4dQ8ZAtrayhuDDmkY")
+	if se, ok := err.(Error); !ok || se.Status != 503 {
+		t.Error("Expected the last server error, got", err)
+	}
+	if l := len(rt.requests); l != 3 {
+		t.Errorf("Expected 3 requests, got %d\n", l)
+	}
+}
+
+func TestRetrySkipsNonIdempotent(t *testing.T) {
+	defer fastRetries()()
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusServiceUnavailable, body: serverError},
+		cannedResponse{statusCode: http.StatusOK},
+	)
+	client.AutoRetry = true
+	err := client.AddTracksToLibrary("4iV5W9uYEdYUVa79Axb7Rh")
+	if err == nil {
+		t.Error("Expected an error")
+	}
+	if l := len(rt.requests); l != 1 {
+		t.Errorf("Expected 1 request, got %d\n", l)
+	}
+}
+
+func TestRetryNonIdempotentResendsBody(t *testing.T) {
+	defer fastRetries()()
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusServiceUnavailable, body: serverError},
+		cannedResponse{statusCode: http.StatusOK},
+	)
+	client.AutoRetry = true
+	client.RetryNonIdempotent = true
+	err := client.FollowPlaylist("ownerID", "playlistID", true)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if l := len(rt.requests); l != 2 {
+		t.Errorf("Expected 2 requests, got %d\n", l)
+		return
+	}
+	for i, body := range rt.bodies {
+		if body != "true" {
+			t.Errorf("Request %d: wanted body 'true', got '%s'\n", i, body)
+		}
+	}
+}
+
+func TestRetryReplaysPlaylistBodies(t *testing.T) {
+	defer fastRetries()()
+	calls := []struct {
+		name string
+		call func(c *Client) error
+	}{
+		{"RemoveTracksFromPlaylist", func(c *Client) error {
+			_, err := c.RemoveTracksFromPlaylist("user", "playlist", "track1")
+			return err
+		}},
+		{"ReorderPlaylistTracks", func(c *Client) error {
+			_, err := c.ReorderPlaylistTracks("user", "playlist", PlaylistReorderOptions{RangeStart: 1, InsertBefore: 3})
+			return err
+		}},
+		{"ChangePlaylistName", func(c *Client) error {
+			return c.ChangePlaylistName("user", "playlist", "new name")
+		}},
+	}
+	for _, tt := range calls {
+		client, rt := testClientSequence(
+			cannedResponse{statusCode: http.StatusServiceUnavailable, body: serverError},
+			cannedResponse{statusCode: http.StatusOK, body: `{ "snapshot_id": "s" }`},
+		)
+		client.AutoRetry = true
+		client.RetryNonIdempotent = true
+		if err := tt.call(client); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if l := len(rt.bodies); l != 2 {
+			t.Errorf("%s: expected 2 requests, got %d", tt.name, l)
+			continue
+		}
+		if rt.bodies[0] == "" || rt.bodies[1] != rt.bodies[0] {
+			t.Errorf("%s: retried body %q doesn't match original %q", tt.name, rt.bodies[1], rt.bodies[0])
+		}
+	}
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{
+			statusCode: http.StatusTooManyRequests,
+			header:     http.Header{"Retry-After": []string{"0"}},
+			body:       `{ "error": { "status": 429, "message": "API rate limit exceeded" } }`,
+		},
+		cannedResponse{statusCode: http.StatusOK},
+	)
+	client.AutoRetry = true
+	err := client.AddTracksToLibrary("4iV5W9uYEdYUVa79Axb7Rh")
+	if err != nil {
+		t.Error(err)
+	}
+	if l := len(rt.requests); l != 2 {
+		t.Errorf("Expected 2 requests, got %d\n", l)
+	}
+}
+
+// concurrencyRoundTripper records the largest number of requests
+// it has seen in flight at the same time.
+type concurrencyRoundTripper struct {
+	mu       sync.Mutex
+	inFlight int
+	max      int
+}
+
+func (c *concurrencyRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.inFlight++
+	if c.inFlight > c.max {
+		c.max = c.inFlight
+	}
+	c.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	c.mu.Lock()
+	c.inFlight--
+	c.mu.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"id": "abc"}`)),
+	}, nil
+}
+
+func TestSetMaxConcurrency(t *testing.T) {
+	rt := &concurrencyRoundTripper{}
+	client := &Client{http: &http.Client{Transport: rt}}
+	client.SetMaxConcurrency(2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.GetTrack("abc"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if rt.max != 2 {
+		t.Errorf("Expected at most 2 requests in flight, got %d", rt.max)
+	}
+
+	client.SetMaxConcurrency(0)
+	if client.limiter != nil {
+		t.Error("Expected SetMaxConcurrency(0) to remove the limit")
+	}
+}
+
+func TestRateLimitPausesAllRequests(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusTooManyRequests, header: http.Header{"Retry-After": {"1"}}, body: `{}`},
+		cannedResponse{statusCode: http.StatusOK, body: `{"id": "abc"}`},
+	)
+	client.SetMaxConcurrency(4)
+	if _, err := client.GetTrack("abc"); err == nil {
+		t.Fatal("Expected the rate limited request to fail without AutoRetry")
+	}
+	start := time.Now()
+	if _, err := client.GetTrack("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 900*time.Millisecond {
+		t.Errorf("Expected the next request to wait for the Retry-After delay, waited %v", d)
+	}
+	if len(rt.requests) != 2 {
+		t.Errorf("Expected 2 requests, got %d", len(rt.requests))
+	}
+}
+
+func TestExternalIDs(t *testing.T) {
+	client := testClientFile(http.StatusOK, "test_data/find_track.txt")
+	track, err := client.GetTrack("1zHlj4dQ8ZAtrayhuDDmkY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track.ExternalIDs.Key != "isrc" || track.ExternalIDs.Value == "" {
+		t.Errorf("Expected an ISRC, got %+v", track.ExternalIDs)
+	}
+	if track.ExternalURLs.Key != "spotify" || !strings.HasPrefix(track.ExternalURLs.Value, "https://open.spotify.com/") {
+		t.Errorf("Expected a Spotify URL, got %+v", track.ExternalURLs)
+	}
+	b, err := json.Marshal(track.ExternalIDs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"isrc":"` + track.ExternalIDs.Value + `"}`; string(b) != want {
+		t.Errorf("Expected %s, got %s", want, b)
+	}
+}
+
+func TestExternalIDPriority(t *testing.T) {
+	tests := []struct {
+		json, key, value string
+	}{
+		{`{"ean": "5099749994324", "isrc": "GBAYE0601498", "upc": "00602517512078"}`, "isrc", "GBAYE0601498"},
+		{`{"upc": "00602517512078", "ean": "5099749994324"}`, "ean", "5099749994324"},
+		{`{"upc": "00602517512078"}`, "upc", "00602517512078"},
+		{`{"zzz": "2", "aaa": "1"}`, "aaa", "1"},
+	}
+	for _, test := range tests {
+		var id ExternalID
+		if err := json.Unmarshal([]byte(test.json), &id); err != nil {
+			t.Fatal(err)
+		}
+		if id.Key != test.key || id.Value != test.value {
+			t.Errorf("%s: expected %s=%s, got %+v", test.json, test.key, test.value, id)
+		}
+	}
+
+	var u ExternalURL
+	if err := json.Unmarshal([]byte(`{"other": "https://example.com", "spotify": "https://open.spotify.com/track/x"}`), &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Key != "spotify" {
+		t.Errorf("Expected the Spotify URL, got %+v", u)
+	}
+}
+
+func TestSetUserAgent(t *testing.T) {
+	client, rt := testClientSequence(cannedResponse{statusCode: http.StatusOK, body: `{ "id": "abc" }`})
+	if _, err := client.GetTrack("abc"); err != nil {
+		t.Fatal(err)
+	}
+	client.SetUserAgent("my-app/1.2")
+	if _, err := client.GetTrack("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if ua := rt.requests[0].Header.Get("User-Agent"); ua != "go-spotify" {
+		t.Errorf("Expected the default User-Agent, got %q", ua)
+	}
+	if ua := rt.requests[1].Header.Get("User-Agent"); ua != "my-app/1.2" {
+		t.Errorf("Expected User-Agent my-app/1.2, got %q", ua)
+	}
+}
+
+func TestGetRaw(t *testing.T) {
+	body := `{ "id": "abc", "some_new_field": 42 }`
+	client, rt := testClientSequence(cannedResponse{statusCode: http.StatusOK, body: body})
+	raw, err := client.GetRaw(context.Background(), "tracks/abc?market=US")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != body {
+		t.Errorf("Expected %s, got %s", body, raw)
+	}
+	if u := rt.requests[0].URL.String(); u != "https://api.spotify.com/v1/tracks/abc?market=US" {
+		t.Error("Unexpected request URL", u)
+	}
+
+	if _, err := client.GetRaw(context.Background(), "https://api.spotify.com/v1/me/tracks?offset=20"); err != nil {
+		t.Fatal(err)
+	}
+	if u := rt.requests[1].URL.String(); u != "https://api.spotify.com/v1/me/tracks?offset=20" {
+		t.Error("Unexpected request URL", u)
+	}
+
+	client = testClientString(http.StatusNotFound, `{ "error": { "status": 404, "message": "non existing id" } }`)
+	if _, err := client.GetRaw(context.Background(), "tracks/nope"); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func TestIDValid(t *testing.T) {
+	for _, id := range []ID{"6rqhFgbbKwnb9MLmUQDhG6", "0000000000000000000000"} {
+		if !id.Valid() {
+			t.Errorf("Expected %s to be valid", id)
+		}
+	}
+	for _, id := range []ID{"", "6rqhFgbbKwnb9MLmUQDhG", "6rqhFgbbKwnb9MLmUQDhG6x", "6rqhFgbbKwnb9MLmUQDh-6"} {
+		if id.Valid() {
+			t.Errorf("Expected %s to be invalid", id)
+		}
+	}
+}
+
+func TestGzipResponses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			t.Errorf("Expected Accept-Encoding gzip, got %q", r.Header.Get("Accept-Encoding"))
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte(`{"id": "abc"}`))
+		zw.Close()
+	}))
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL + "/"}
+	raw, err := client.GetRaw(context.Background(), "tracks/abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != `{"id": "abc"}` {
+		t.Errorf("Expected decompressed body, got %q", raw)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := &Client{BaseURL: server.URL + "/", Timeout: 20 * time.Millisecond}
+	if _, err := client.GetRaw(context.Background(), "slow"); err == nil {
+		t.Error("Expected the slow request to time out")
+	}
+	if _, err := client.GetRaw(context.Background(), "fast"); err != nil {
+		t.Error("Expected the fast request to succeed, got", err)
+	}
+
+	// a deadline on the context takes precedence over Timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client.Timeout = time.Nanosecond
+	if _, err := client.GetRaw(ctx, "fast"); err != nil {
+		t.Error("Expected the context deadline to be used, got", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	date := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header http.Header
+		want   time.Duration
+	}{
+		{http.Header{"Retry-After": {"3"}}, 3 * time.Second},
+		{http.Header{"Retry-After": {"0"}}, 0},
+		{http.Header{
+			"Retry-After": {date.Add(90 * time.Second).Format(http.TimeFormat)},
+			"Date":        {date.Format(http.TimeFormat)},
+		}, 90 * time.Second},
+		{http.Header{
+			"Retry-After": {date.Add(-time.Minute).Format(http.TimeFormat)},
+			"Date":        {date.Format(http.TimeFormat)},
+		}, 0},
+	}
+	for _, test := range tests {
+		resp := &http.Response{Header: test.header}
+		if got := retryAfter(resp, 0); got != test.want {
+			t.Errorf("Retry-After %q: expected %v, got %v", test.header.Get("Retry-After"), test.want, got)
+		}
+	}
+
+	// without a Date header, the delay is measured from now
+	resp := &http.Response{Header: http.Header{
+		"Retry-After": {time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)},
+	}}
+	if got := retryAfter(resp, 0); got <= 55*time.Second || got > time.Minute {
+		t.Errorf("Expected a delay of about a minute, got %v", got)
+	}
+
+	// an unparseable header falls back to backoff
+	defer fastRetries()()
+	resp = &http.Response{Header: http.Header{"Retry-After": {"soon"}}}
+	if got := retryAfter(resp, 0); got > time.Second {
+		t.Errorf("Expected a short backoff delay, got %v", got)
+	}
+}
+
+// TestCompatibleSignatures fails to compile if an API that existing
+// callers depend on changes its signature.  Replacements should be added
+// under new names, with the old ones kept as deprecated wrappers.
+func TestCompatibleSignatures(t *testing.T) {
+	var (
+		_ func(ID, int, int) (*SimpleTrackPage, error)                   = GetAlbumTracksOpt
+		_ func(ID, int, int) (*SimpleTrackPage, error)                   = (&Client{}).GetAlbumTracksOpt
+		_ func(string, SearchType, *Options) (*SearchResult, error)      = SearchOpt
+		_ func(string, SearchType, *Options) (*SearchResult, error)      = (&Client{}).SearchOpt
+		_ func(string, ID, *Options, string) (*PlaylistTrackPage, error) = (&Client{}).GetPlaylistTracksOpt
+	)
+	_ = FullAlbum{ReleaseDate: "1981", ReleaseDatePrecision: "year"}
+	if AlbummTypeAppearsOn != AlbumTypeAppearsOn {
+		t.Error("AlbummTypeAppearsOn should still match AlbumTypeAppearsOn")
+	}
+}
+
+func TestRetryBackoffCanceled(t *testing.T) {
+	client, _ := testClientSequence(cannedResponse{
+		statusCode: http.StatusTooManyRequests,
+		header:     http.Header{"Retry-After": {"30"}},
+		body:       `{}`,
+	})
+	client.AutoRetry = true
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := client.GetRaw(ctx, "tracks/abc")
+	if err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Expected the backoff to stop when the context was canceled, took %v", d)
+	}
+}
+
+func TestRateLimitPauseCanceled(t *testing.T) {
+	client, rt := testClientSequence(cannedResponse{
+		statusCode: http.StatusTooManyRequests,
+		header:     http.Header{"Retry-After": {"30"}},
+		body:       `{}`,
+	})
+	client.SetMaxConcurrency(1)
+	if _, err := client.GetTrack("abc"); err == nil {
+		t.Fatal("Expected the rate limited request to fail without AutoRetry")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.GetRaw(ctx, "tracks/abc"); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("Expected the pause to stop at the deadline, took %v", d)
+	}
+	if len(rt.requests) != 1 {
+		t.Errorf("Expected the paused request not to be sent, got %d requests", len(rt.requests))
+	}
+	// the canceled request must have given its slot back
+	client.limiter.pausedUntil = time.Time{}
+	if _, err := client.GetRaw(context.Background(), "tracks/abc"); err == nil {
+		t.Error("Expected the 429 response as an error")
+	}
+}
@@ -0,0 +1,382 @@
+// Copyright 2014, 2015 Zac Bergquist
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package spotifytest provides a fake Spotify Web API server for testing
+// code that uses the spotify package.
+//
+// The server is seeded with catalog data and serves it back in the same
+// format as the Web API, including paging.  Point a spotify.Client at it
+// by setting the client's BaseURL, or use Server.Client:
+//
+//	srv := spotifytest.NewServer()
+//	defer srv.Close()
+//	srv.AddTrack(spotify.FullTrack{...})
+//
+//	client := srv.Client()
+//	track, err := client.GetTrack(id)
+package spotifytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/zmb3/spotify"
+)
+
+// DefaultPageSize is the number of items returned in a page when the
+// request doesn't specify a limit.
+const DefaultPageSize = 20
+
+type album struct {
+	spotify.FullAlbum
+	tracks []spotify.SimpleTrack
+}
+
+type playlist struct {
+	spotify.FullPlaylist
+	tracks []spotify.PlaylistTrack
+}
+
+// Server is a fake Spotify Web API server.  It is safe to add data to a
+// Server while it is serving requests.
+type Server struct {
+	srv *httptest.Server
+
+	mu        sync.Mutex
+	tracks    map[spotify.ID]spotify.FullTrack
+	albums    map[spotify.ID]album
+	artists   map[spotify.ID]spotify.FullArtist
+	playlists map[string][]playlist // by owner
+}
+
+// NewServer starts a fake Web API server with no data.  The caller should
+// call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		tracks:    make(map[spotify.ID]spotify.FullTrack),
+		albums:    make(map[spotify.ID]album),
+		artists:   make(map[spotify.ID]spotify.FullArtist),
+		playlists: make(map[string][]playlist),
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// URL returns the base URL of the fake Web API, suitable for use as
+// spotify.Client.BaseURL.
+func (s *Server) URL() string {
+	return s.srv.URL + "/v1/"
+}
+
+// Client returns an unauthenticated spotify.Client that sends its
+// requests to the server.
+func (s *Server) Client() *spotify.Client {
+	return &spotify.Client{BaseURL: s.URL()}
+}
+
+// AddTrack adds a track to the catalog.
+func (s *Server) AddTrack(t spotify.FullTrack) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tracks[t.ID] = t
+}
+
+// AddArtist adds an artist to the catalog.
+func (s *Server) AddArtist(a spotify.FullArtist) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.artists[a.ID] = a
+}
+
+// AddAlbum adds an album and its tracks to the catalog.  The album's
+// Tracks field is ignored; it is generated from the tracks argument.
+func (s *Server) AddAlbum(a spotify.FullAlbum, tracks ...spotify.SimpleTrack) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.albums[a.ID] = album{a, tracks}
+}
+
+// AddPlaylist adds a playlist owned by the specified user.  The playlist's
+// Tracks field is ignored; it is generated from the tracks argument.
+func (s *Server) AddPlaylist(userID string, p spotify.FullPlaylist, tracks ...spotify.PlaylistTrack) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.playlists[userID] = append(s.playlists[userID], playlist{p, tracks})
+}
+
+// page is a Web API paging object.
+type page struct {
+	Endpoint string      `json:"href"`
+	Items    interface{} `json:"items"`
+	Limit    int         `json:"limit"`
+	Offset   int         `json:"offset"`
+	Total    int         `json:"total"`
+	Next     *string     `json:"next"`
+	Previous *string     `json:"previous"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "method not supported by spotifytest")
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/v1/") {
+		writeError(w, http.StatusNotFound, "service not found")
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case len(parts) == 1 && parts[0] == "tracks":
+		s.serveSeveral(w, r, "tracks", func(id spotify.ID) (interface{}, bool) {
+			t, ok := s.tracks[id]
+			return t, ok
+		})
+	case len(parts) == 2 && parts[0] == "tracks":
+		t, ok := s.tracks[spotify.ID(parts[1])]
+		writeObject(w, t, ok)
+	case len(parts) == 1 && parts[0] == "artists":
+		s.serveSeveral(w, r, "artists", func(id spotify.ID) (interface{}, bool) {
+			a, ok := s.artists[id]
+			return a, ok
+		})
+	case len(parts) == 2 && parts[0] == "artists":
+		a, ok := s.artists[spotify.ID(parts[1])]
+		writeObject(w, a, ok)
+	case len(parts) == 1 && parts[0] == "albums":
+		s.serveSeveral(w, r, "albums", func(id spotify.ID) (interface{}, bool) {
+			a, ok := s.albums[id]
+			if !ok {
+				return nil, false
+			}
+			return s.fullAlbum(a), true
+		})
+	case len(parts) == 2 && parts[0] == "albums":
+		a, ok := s.albums[spotify.ID(parts[1])]
+		if !ok {
+			writeObject(w, nil, false)
+			return
+		}
+		writeObject(w, s.fullAlbum(a), true)
+	case len(parts) == 3 && parts[0] == "albums" && parts[2] == "tracks":
+		a, ok := s.albums[spotify.ID(parts[1])]
+		if !ok {
+			writeObject(w, nil, false)
+			return
+		}
+		s.servePage(w, r, r.URL.Path, len(a.tracks), 50, func(i, j int) interface{} {
+			return a.tracks[i:j]
+		})
+	case len(parts) == 3 && parts[0] == "users" && parts[2] == "playlists":
+		owned := s.playlists[parts[1]]
+		s.servePage(w, r, r.URL.Path, len(owned), 50, func(i, j int) interface{} {
+			result := make([]spotify.SimplePlaylist, 0, j-i)
+			for _, p := range owned[i:j] {
+				simple := p.SimplePlaylist
+				simple.Tracks = spotify.PlaylistTracks{
+					Endpoint: s.srv.URL + r.URL.Path + "/" + string(p.ID) + "/tracks",
+					Total:    uint(len(p.tracks)),
+				}
+				result = append(result, simple)
+			}
+			return result
+		})
+	case len(parts) == 4 && parts[0] == "users" && parts[2] == "playlists":
+		p, ok := s.playlist(parts[1], spotify.ID(parts[3]))
+		if !ok {
+			writeObject(w, nil, false)
+			return
+		}
+		writeObject(w, struct {
+			spotify.FullPlaylist
+			Tracks *page `json:"tracks"`
+		}{
+			p.FullPlaylist,
+			s.firstPage(r.URL.Path+"/tracks", p.tracks, len(p.tracks), 100),
+		}, true)
+	case len(parts) == 5 && parts[0] == "users" && parts[2] == "playlists" && parts[4] == "tracks":
+		p, ok := s.playlist(parts[1], spotify.ID(parts[3]))
+		if !ok {
+			writeObject(w, nil, false)
+			return
+		}
+		s.servePage(w, r, r.URL.Path, len(p.tracks), 100, func(i, j int) interface{} {
+			return p.tracks[i:j]
+		})
+	default:
+		writeError(w, http.StatusNotFound, "endpoint not supported by spotifytest")
+	}
+}
+
+func (s *Server) playlist(userID string, id spotify.ID) (playlist, bool) {
+	for _, p := range s.playlists[userID] {
+		if p.ID == id {
+			return p, true
+		}
+	}
+	return playlist{}, false
+}
+
+// fullAlbum returns the JSON representation of an album, including the
+// first page of its tracks.
+func (s *Server) fullAlbum(a album) interface{} {
+	return struct {
+		spotify.FullAlbum
+		Tracks *page `json:"tracks"`
+	}{
+		a.FullAlbum,
+		s.firstPage("/v1/albums/"+string(a.ID)+"/tracks", a.tracks, len(a.tracks), 50),
+	}
+}
+
+// firstPage builds the first page of items, as embedded in full objects.
+func (s *Server) firstPage(path string, items interface{}, total, limit int) *page {
+	end := total
+	if end > limit {
+		end = limit
+	}
+	p := s.newPage(path, url.Values{}, 0, limit, total)
+	switch v := items.(type) {
+	case []spotify.SimpleTrack:
+		p.Items = v[:end]
+	case []spotify.PlaylistTrack:
+		p.Items = v[:end]
+	}
+	return p
+}
+
+// serveSeveral serves the "get several objects" endpoints, which return
+// null for IDs that aren't found.
+func (s *Server) serveSeveral(w http.ResponseWriter, r *http.Request, key string,
+	lookup func(spotify.ID) (interface{}, bool)) {
+
+	ids := strings.Split(r.URL.Query().Get("ids"), ",")
+	result := make([]interface{}, len(ids))
+	for i, id := range ids {
+		if obj, ok := lookup(spotify.ID(id)); ok {
+			result[i] = obj
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{key: result})
+}
+
+// servePage serves a page of items, as selected by the limit and offset
+// query parameters.  items returns the items in the range [i, j).
+func (s *Server) servePage(w http.ResponseWriter, r *http.Request, path string,
+	total, maxLimit int, items func(i, j int) interface{}) {
+
+	query := r.URL.Query()
+	limit, offset := DefaultPageSize, 0
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > maxLimit {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = n
+	}
+	if o := query.Get("offset"); o != "" {
+		n, err := strconv.Atoi(o)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid offset")
+			return
+		}
+		offset = n
+	}
+	start, end := offset, offset+limit
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	p := s.newPage(path, query, offset, limit, total)
+	p.Items = items(start, end)
+	writeJSON(w, http.StatusOK, p)
+}
+
+// newPage creates a page object (without items) whose links
+// preserve the other query parameters of the original request.
+func (s *Server) newPage(path string, query url.Values, offset, limit, total int) *page {
+	link := func(offset int) string {
+		v := url.Values{}
+		for key, val := range query {
+			v[key] = val
+		}
+		v.Set("offset", strconv.Itoa(offset))
+		v.Set("limit", strconv.Itoa(limit))
+		return s.srv.URL + path + "?" + v.Encode()
+	}
+	p := &page{
+		Endpoint: link(offset),
+		Limit:    limit,
+		Offset:   offset,
+		Total:    total,
+	}
+	if offset+limit < total {
+		next := link(offset + limit)
+		p.Next = &next
+	}
+	if offset > 0 {
+		prev := offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		previous := link(prev)
+		p.Previous = &previous
+	}
+	return p
+}
+
+func writeObject(w http.ResponseWriter, obj interface{}, found bool) {
+	if !found {
+		writeError(w, http.StatusNotFound, "non existing id")
+		return
+	}
+	writeJSON(w, http.StatusOK, obj)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	var e struct {
+		E spotify.Error `json:"error"`
+	}
+	e.E.Status = status
+	e.E.Message = message
+	writeJSON(w, status, e)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("spotifytest: couldn't encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
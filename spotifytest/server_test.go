@@ -0,0 +1,136 @@
+// Copyright 2014, 2015 Zac Bergquist
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spotifytest
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/zmb3/spotify"
+)
+
+func TestGetTrack(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	track := spotify.FullTrack{Popularity: 42}
+	track.ID = "track1"
+	track.Name = "Timber"
+	srv.AddTrack(track)
+
+	client := srv.Client()
+	got, err := client.GetTrack("track1")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if got.Name != "Timber" || got.Popularity != 42 {
+		t.Errorf("Unexpected track: %+v\n", got)
+	}
+
+	_, err = client.GetTrack("missing")
+	if se, ok := err.(spotify.Error); !ok || se.Status != http.StatusNotFound {
+		t.Error("Expected HTTP 404, got", err)
+	}
+}
+
+func TestGetSeveralTracks(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	var track spotify.FullTrack
+	track.ID = "track1"
+	srv.AddTrack(track)
+
+	tracks, err := srv.Client().GetTracks("track1", "missing")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(tracks) != 2 || tracks[0] == nil || tracks[1] != nil {
+		t.Errorf("Expected [track, nil], got %v\n", tracks)
+	}
+}
+
+func TestAlbumTracksPaging(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	var a spotify.FullAlbum
+	a.ID = "album1"
+	a.Name = "Box Set"
+	tracks := make([]spotify.SimpleTrack, 120)
+	for i := range tracks {
+		tracks[i].ID = spotify.ID(fmt.Sprintf("track%d", i))
+		tracks[i].TrackNumber = i + 1
+	}
+	srv.AddAlbum(a, tracks...)
+
+	client := srv.Client()
+	album, err := client.GetAlbum("album1")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if album.Tracks.Total != 120 || len(album.Tracks.Tracks) != 50 || album.Tracks.Next == "" {
+		t.Errorf("Expected first page of 50 out of 120 tracks, got %d of %d\n",
+			len(album.Tracks.Tracks), album.Tracks.Total)
+	}
+
+	all, err := client.GetAlbumTracksAll("album1", nil)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(all) != 120 {
+		t.Errorf("Expected 120 tracks, got %d\n", len(all))
+		return
+	}
+	for i, track := range all {
+		if track.TrackNumber != i+1 {
+			t.Errorf("Track %d has track number %d\n", i, track.TrackNumber)
+			return
+		}
+	}
+}
+
+func TestPlaylistTracks(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	var p spotify.FullPlaylist
+	p.ID = "playlist1"
+	p.Name = "Favorites"
+	var item spotify.PlaylistTrack
+	item.Track.Name = "Timber"
+	srv.AddPlaylist("wizzler", p, item, item, item)
+
+	client := srv.Client()
+	playlists, err := client.GetPlaylistsForUser("wizzler")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(playlists.Playlists) != 1 || playlists.Playlists[0].Tracks.Total != 3 {
+		t.Errorf("Unexpected playlists: %+v\n", playlists.Playlists)
+	}
+
+	limit := 2
+	page, err := client.GetPlaylistTracksOpt("wizzler", "playlist1", &spotify.Options{Limit: &limit}, "")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if page.Total != 3 || len(page.Tracks) != 2 || page.Next == "" {
+		t.Errorf("Expected first 2 of 3 tracks, got %d of %d\n", len(page.Tracks), page.Total)
+	}
+}
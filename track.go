@@ -15,10 +15,15 @@
 package spotify
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -30,7 +35,8 @@ type SimpleTrack struct {
 	AvailableMarkets []string `json:"available_markets"`
 	// The disc number (usually 1 unless the album consists of more than one disc).
 	DiscNumber int `json:"disc_number"`
-	// The length of the track, in milliseconds.
+	// The length of the track, in milliseconds.  Use TimeDuration
+	// to get it as a time.Duration value.
 	Duration int `json:"duration_ms"`
 	// Whether or not the track has explicit lyrics.
 	// true => yes, it does; false => no, it does not.
@@ -41,13 +47,45 @@ type SimpleTrack struct {
 	Endpoint string `json:"href"`
 	ID       ID     `json:"id"`
 	Name     string `json:"name"`
-	// A URL to a 30 second preview (MP3) of the track.
+	// A URL to a 30 second preview (MP3) of the track.  Previews
+	// aren't available for every track in every market, in which case
+	// PreviewURL is empty.  See HasPreview.
 	PreviewURL string `json:"preview_url"`
 	// The number of the track.  If an album has several
 	// discs, the track number is the number on the specified
 	// DiscNumber.
 	TrackNumber int `json:"track_number"`
 	URI         URI `json:"uri"`
+	// IsPlayable is only set when the track is requested with a market.
+	// It reports whether the track can be played in that market.
+	IsPlayable *bool `json:"is_playable"`
+	// Restrictions is only set when the track is requested with a market
+	// and the track can't be played there.
+	Restrictions *Restrictions `json:"restrictions"`
+	// LinkedFrom is only set when the track is requested with a market
+	// and Track Relinking replaced the requested track with one that is
+	// available there.  It identifies the track that was originally
+	// requested.
+	LinkedFrom *LinkedTrack `json:"linked_from"`
+}
+
+// LinkedTrack identifies the original track when Track Relinking has
+// replaced it with another version.
+type LinkedTrack struct {
+	ExternalURLs ExternalURL `json:"external_urls"`
+	// A link to the Web API endpoint providing full details for the track.
+	Endpoint string `json:"href"`
+	ID       ID     `json:"id"`
+	URI      URI    `json:"uri"`
+}
+
+// Restrictions explains why an item can't be played.
+type Restrictions struct {
+	// The reason for the restriction: "market" if the item isn't available
+	// in the requested market, "product" if it isn't available for the
+	// user's subscription type, or "explicit" if the user's account is set
+	// to not play explicit content.  Spotify may add other reasons.
+	Reason string `json:"reason"`
 }
 
 // FullTrack provides extra track data in addition to what is provided by SimpleTrack.
@@ -77,6 +115,14 @@ type PlaylistTrack struct {
 	Track FullTrack `json:"track"`
 }
 
+// AddedAtTime returns the time the track was added to the playlist as a
+// time.Time value.  It returns the zero time if AddedAt isn't set, which
+// can happen for very old playlists.
+func (p *PlaylistTrack) AddedAtTime() time.Time {
+	t, _ := time.Parse(TimestampLayout, p.AddedAt)
+	return t
+}
+
 // SavedTrack provides info about a track saved to a user's account.
 type SavedTrack struct {
 	// The date and time the track was saved, represented as an ISO
@@ -87,6 +133,75 @@ type SavedTrack struct {
 	FullTrack `json:"track"`
 }
 
+// AddedAtTime returns the time the track was saved as a time.Time value.
+// It returns the zero time if AddedAt isn't a valid timestamp.
+func (s *SavedTrack) AddedAtTime() time.Time {
+	t, _ := time.Parse(TimestampLayout, s.AddedAt)
+	return t
+}
+
+// FilterByPopularity returns the tracks whose popularity is at least min,
+// in their original order.  The tracks slice isn't modified.
+func FilterByPopularity(tracks []FullTrack, min int) []FullTrack {
+	var result []FullTrack
+	for _, t := range tracks {
+		if t.Popularity >= min {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// SortSavedTracksByAddedAt sorts tracks by the time they were saved, oldest
+// first, or newest first if desc is true.  Tracks saved at the same time
+// keep their relative order.
+func SortSavedTracksByAddedAt(tracks []SavedTrack, desc bool) {
+	sort.SliceStable(tracks, func(i, j int) bool {
+		ti, tj := tracks[i].AddedAtTime(), tracks[j].AddedAtTime()
+		if desc {
+			return ti.After(tj)
+		}
+		return ti.Before(tj)
+	})
+}
+
+// HasPreview reports whether a 30 second preview of the track is available.
+// Whether Spotify returns a preview depends on the market the track was
+// requested for, so requesting tracks with the Country option set to
+// MarketFromToken (see GetTrackOpt) makes a preview more likely to be
+// present for the current user.
+func (t *SimpleTrack) HasPreview() bool {
+	return t.PreviewURL != ""
+}
+
+// ErrNoPreview is returned by DownloadPreview for tracks that don't have a
+// preview.
+var ErrNoPreview = errors.New("spotify: track has no preview")
+
+// DownloadPreview downloads the 30 second MP3 preview of a track and returns
+// its contents.  It returns ErrNoPreview if the track doesn't have a preview
+// (see SimpleTrack.HasPreview).  Previews are served from Spotify's CDN,
+// which doesn't need authorization, so the request is sent without the
+// client's access token.
+func (c *Client) DownloadPreview(ctx context.Context, track *FullTrack) ([]byte, error) {
+	if !track.HasPreview() {
+		return nil, ErrNoPreview
+	}
+	req, err := http.NewRequest("GET", track.PreviewURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.unauthenticatedClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("spotify: couldn't download preview: HTTP %d", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
 // TimeDuration returns the track's duration as a time.Duration value.
 func (t *SimpleTrack) TimeDuration() time.Duration {
 	return time.Duration(t.Duration) * time.Millisecond
@@ -100,23 +215,168 @@ func GetTrack(id ID) (*FullTrack, error) {
 // GetTrack gets Spotify catalog information for
 // a single track identified by its unique Spotify ID.
 func (c *Client) GetTrack(id ID) (*FullTrack, error) {
-	spotifyURL := baseAddress + "tracks/" + string(id)
-	resp, err := c.http.Get(spotifyURL)
+	return c.GetTrackOpt(id, nil)
+}
+
+// GetTrackOpt is a wrapper around DefaultClient.GetTrackOpt.
+func GetTrackOpt(id ID, opt *Options) (*FullTrack, error) {
+	return DefaultClient.GetTrackOpt(id, opt)
+}
+
+// GetTrackOpt is like GetTrack, but it accepts optional parameters.
+// If the Country option is specified, it is used as the market for
+// Track Relinking, and the track's IsPlayable and Restrictions fields
+// are populated.  The constant MarketFromToken can be used with
+// authenticated clients to use the country of the current user.
+func (c *Client) GetTrackOpt(id ID, opt *Options) (*FullTrack, error) {
+	spotifyURL := c.baseURL() + "tracks/" + string(id)
+	if opt != nil && opt.Country != nil {
+		spotifyURL += "?market=" + url.QueryEscape(*opt.Country)
+	}
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var t FullTrack
-	err = json.NewDecoder(resp.Body).Decode(&t)
+	err = c.decode(resp.Body, &t)
 	if err != nil {
 		return nil, err
 	}
+	if opt != nil && opt.Country != nil {
+		c.RelinkCache.add(*opt.Country, &t)
+	}
 	return &t, nil
 }
 
+// RelinkCache remembers which track Spotify substitutes for a requested
+// track in each market (see Track Relinking).  Set Client.RelinkCache to
+// have the client record the mapping whenever it fetches tracks for a
+// market, then use Lookup or Client.RelinkedTrackID to avoid fetching the
+// same track again.  The zero value is an empty cache ready to use.  A
+// RelinkCache is safe for concurrent use, and can be shared between clients.
+//
+// Markets are recorded as given, so tracks fetched with MarketFromToken
+// are only found again with MarketFromToken.  Don't share such a cache
+// between clients of different users.
+type RelinkCache struct {
+	mu     sync.Mutex
+	tracks map[relinkKey]ID
+}
+
+type relinkKey struct {
+	market string
+	id     ID
+}
+
+// NewRelinkCache creates an empty RelinkCache.
+func NewRelinkCache() *RelinkCache {
+	return &RelinkCache{tracks: make(map[relinkKey]ID)}
+}
+
+// Lookup returns the ID of the track that is played in market in place of
+// the track with the specified ID.  If the track wasn't relinked, that is
+// the ID itself.  The second result is false if the track hasn't been
+// fetched for that market yet.
+func (r *RelinkCache) Lookup(market string, id ID) (ID, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	played, ok := r.tracks[relinkKey{market, id}]
+	return played, ok
+}
+
+// add records the track that was returned when t was requested for
+// market.  It does nothing if r is nil.
+func (r *RelinkCache) add(market string, t *FullTrack) {
+	if r == nil || t == nil || t.ID == "" {
+		return
+	}
+	requested := t.ID
+	if t.LinkedFrom != nil {
+		requested = t.LinkedFrom.ID
+	}
+	r.mu.Lock()
+	if r.tracks == nil {
+		r.tracks = make(map[relinkKey]ID)
+	}
+	r.tracks[relinkKey{market, requested}] = t.ID
+	r.mu.Unlock()
+}
+
+// RelinkedTrackID returns the ID of the track that is played in market in
+// place of the track with the specified ID, which is the ID itself if the
+// track isn't relinked there.  If the client has a RelinkCache that already
+// knows the answer, no request is made.
+func (c *Client) RelinkedTrackID(id ID, market string) (ID, error) {
+	if c.RelinkCache != nil {
+		if played, ok := c.RelinkCache.Lookup(market, id); ok {
+			return played, nil
+		}
+	}
+	t, err := c.GetTrackOpt(id, &Options{Country: &market})
+	if err != nil {
+		return "", err
+	}
+	return t.ID, nil
+}
+
+// TrackPlayableForCurrentUser checks whether the current user can play a
+// track, taking into account both the user's country and subscription
+// type (the Product field of their profile).  If the track isn't playable,
+// the reason reported by Spotify is returned as well (see Restrictions for
+// possible values).  When Spotify doesn't give a reason, "product" is
+// reported for users without a premium subscription and "market" otherwise.
+// If Spotify doesn't say whether the track is playable, the result is
+// false with the reason "unknown".
+// This call requires authorization, and that the application has the
+// ScopeUserReadPrivate scope.
+func (c *Client) TrackPlayableForCurrentUser(id ID) (playable bool, reason string, err error) {
+	user, err := c.CurrentUser()
+	if err != nil {
+		return false, "", err
+	}
+	market := MarketFromToken
+	t, err := c.GetTrackOpt(id, &Options{Country: &market})
+	if err != nil {
+		return false, "", err
+	}
+	if t.IsPlayable == nil {
+		return false, "unknown", nil
+	}
+	if *t.IsPlayable {
+		return true, "", nil
+	}
+	if t.Restrictions != nil && t.Restrictions.Reason != "" {
+		return false, t.Restrictions.Reason, nil
+	}
+	if user.Product != "premium" {
+		return false, "product", nil
+	}
+	return false, "market", nil
+}
+
+// TrackMarkets is a wrapper around DefaultClient.TrackMarkets.
+func TrackMarkets(id ID) ([]string, error) {
+	return DefaultClient.TrackMarkets(id)
+}
+
+// TrackMarkets returns the markets in which a track is available, as ISO
+// 3166-1 alpha-2 country codes.  Popular tracks are often available in
+// more than 180 markets.  The list is only returned when the track is
+// requested without a market, so there is no market option: a request for
+// a specific market (including MarketFromToken) replaces the list with the
+// track's IsPlayable field (see GetTrackOpt).
+func (c *Client) TrackMarkets(id ID) ([]string, error) {
+	track, err := c.GetTrack(id)
+	if err != nil {
+		return nil, err
+	}
+	return track.AvailableMarkets, nil
+}
+
 // GetTracks is a wrapper around DefaultClient.GetTracks.
 func GetTracks(ids ...ID) ([]*FullTrack, error) {
 	return DefaultClient.GetTracks(ids...)
@@ -126,27 +386,86 @@ func GetTracks(ids ...ID) ([]*FullTrack, error) {
 // Spotify IDs.  It supports up to 50 tracks in a single call.  Tracks are
 // returned in the order requested.  If a track is not found, that position in the
 // result will be nil.  Duplicate ids in the query will result in duplicate
-// tracks in the result.
+// tracks in the result.  More than 50 IDs results in a TooManyIDsError, and
+// no IDs results in an empty slice without a request being made.
 func (c *Client) GetTracks(ids ...ID) ([]*FullTrack, error) {
-	if len(ids) > 50 {
-		return nil, errors.New("spotify: FindTracks supports up to 50 tracks")
+	return c.getTracks("GetTracks", "", ids)
+}
+
+// GetTracksForCurrentUser is like GetTracks, but it requests the tracks for
+// the current user's country, so that Track Relinking is applied and the
+// tracks' IsPlayable and Restrictions fields are populated.  The country is
+// looked up from the user's profile the first time it's needed, and cached
+// for the lifetime of the Client.  This call requires authorization, and
+// that the application has the ScopeUserReadPrivate scope.
+func (c *Client) GetTracksForCurrentUser(ids ...ID) ([]*FullTrack, error) {
+	if len(ids) == 0 {
+		return []*FullTrack{}, nil
 	}
-	spotifyURL := baseAddress + "tracks?ids=" + strings.Join(toStringSlice(ids), ",")
-	resp, err := c.http.Get(spotifyURL)
+	country, err := c.currentUserCountry()
+	if err != nil {
+		return nil, err
+	}
+	return c.getTracks("GetTracksForCurrentUser", country, ids)
+}
+
+func (c *Client) getTracks(method, market string, ids []ID) ([]*FullTrack, error) {
+	if err := checkIDs(method, 50, ids); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*FullTrack{}, nil
+	}
+	spotifyURL := c.baseURL() + "tracks?ids=" + strings.Join(toStringSlice(ids), ",")
+	if market != "" {
+		spotifyURL += "&market=" + url.QueryEscape(market)
+	}
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 
 	var t struct {
 		Tracks []*FullTrack `jsosn:"tracks"`
 	}
-	err = json.NewDecoder(resp.Body).Decode(&t)
+	err = c.decode(resp.Body, &t)
 	if err != nil {
 		return nil, errors.New("spotify:  couldn't decode tracks")
 	}
+	if market != "" {
+		for _, track := range t.Tracks {
+			c.RelinkCache.add(market, track)
+		}
+	}
 	return t.Tracks, nil
 }
+
+// TrackAvailability is a wrapper around DefaultClient.TrackAvailability.
+func TrackAvailability(id ID, markets ...string) (map[string]bool, error) {
+	return DefaultClient.TrackAvailability(id, markets...)
+}
+
+// TrackAvailability reports whether a track is available in each of the
+// specified markets (ISO 3166-1 alpha-2 country codes).  It makes a single
+// request and checks the track's AvailableMarkets, so it is much cheaper than
+// looking the track up once per market.  The result contains an entry for
+// every requested market.
+func (c *Client) TrackAvailability(id ID, markets ...string) (map[string]bool, error) {
+	t, err := c.GetTrack(id)
+	if err != nil {
+		return nil, err
+	}
+	available := make(map[string]bool, len(t.AvailableMarkets))
+	for _, m := range t.AvailableMarkets {
+		available[m] = true
+	}
+	result := make(map[string]bool, len(markets))
+	for _, m := range markets {
+		result[m] = available[m]
+	}
+	return result, nil
+}
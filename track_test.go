@@ -15,8 +15,12 @@
 package spotify
 
 import (
+	"context"
 	"net/http"
 	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
 )
 
 func TestFindTrack(t *testing.T) {
@@ -63,3 +67,279 @@ func TestFindTracksNotFound(t *testing.T) {
 		t.Error("Expected nil track (invalid ID) but got valid track")
 	}
 }
+
+func TestTrackAvailability(t *testing.T) {
+	client := testClientFile(http.StatusOK, "test_data/find_track.txt")
+	avail, err := client.TrackAvailability(ID("1zHlj4dQ8ZAtrayhuDDmkY"), CountryFrance, CountryUSA)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if l := len(avail); l != 2 {
+		t.Errorf("Wanted 2 results, got %d\n", l)
+	}
+	if !avail[CountryFrance] {
+		t.Error("Expected track to be available in France")
+	}
+	if avail[CountryUSA] {
+		t.Error("Expected track to be unavailable in the USA")
+	}
+}
+
+func TestTrackPlayableForCurrentUser(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{ "id": "me", "product": "premium" }`},
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"id": "1zHlj4dQ8ZAtrayhuDDmkY",
+			"is_playable": false,
+			"restrictions": { "reason": "product" }
+		}`},
+	)
+	playable, reason, err := client.TrackPlayableForCurrentUser("1zHlj4dQ8ZAtrayhuDDmkY")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if playable || reason != "product" {
+		t.Errorf("Wanted (false, product), got (%v, %s)\n", playable, reason)
+	}
+	if p := rt.requests[0].URL.Path; p != "/v1/me" {
+		t.Errorf("Expected the profile to be fetched first, got %s\n", p)
+	}
+	if m := rt.requests[1].URL.Query().Get("market"); m != MarketFromToken {
+		t.Errorf("Wanted market %s, got '%s'\n", MarketFromToken, m)
+	}
+}
+
+func TestTrackPlayableForCurrentUserPlayable(t *testing.T) {
+	client, _ := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{ "id": "me", "product": "free" }`},
+		cannedResponse{statusCode: http.StatusOK, body: `{ "id": "1zHlj4dQ8ZAtrayhuDDmkY", "is_playable": true }`},
+	)
+	playable, reason, err := client.TrackPlayableForCurrentUser("1zHlj4dQ8ZAtrayhuDDmkY")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !playable || reason != "" {
+		t.Errorf("Wanted (true, ''), got (%v, %s)\n", playable, reason)
+	}
+}
+
+func TestTrackPlayableForCurrentUserReason(t *testing.T) {
+	tests := []struct {
+		product string
+		track   string
+		reason  string
+	}{
+		{"free", `{ "id": "abc", "is_playable": false }`, "product"},
+		{"premium", `{ "id": "abc", "is_playable": false }`, "market"},
+		{"premium", `{ "id": "abc" }`, "unknown"},
+	}
+	for _, tt := range tests {
+		client, _ := testClientSequence(
+			cannedResponse{statusCode: http.StatusOK, body: `{ "id": "me", "product": "` + tt.product + `" }`},
+			cannedResponse{statusCode: http.StatusOK, body: tt.track},
+		)
+		playable, reason, err := client.TrackPlayableForCurrentUser("abc")
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if playable || reason != tt.reason {
+			t.Errorf("%s, %s: wanted (false, %s), got (%v, %s)\n", tt.product, tt.track, tt.reason, playable, reason)
+		}
+	}
+}
+
+func TestTimeDuration(t *testing.T) {
+	track := FullTrack{SimpleTrack: SimpleTrack{Duration: 207959}}
+	if d := track.TimeDuration(); d != 207959*time.Millisecond {
+		t.Errorf("Expected 3m27.959s, got %v", d)
+	}
+}
+
+func TestHasPreview(t *testing.T) {
+	client := testClientString(http.StatusOK, `{ "id": "abc", "preview_url": null }`)
+	track, err := client.GetTrack("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if track.HasPreview() || track.PreviewURL != "" {
+		t.Errorf("Expected no preview, got %q", track.PreviewURL)
+	}
+
+	client = testClientFile(http.StatusOK, "test_data/find_track.txt")
+	track, err = client.GetTrack("1zHlj4dQ8ZAtrayhuDDmkY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !track.HasPreview() {
+		t.Error("Expected a preview")
+	}
+}
+
+func TestGetTracksIDLimits(t *testing.T) {
+	client := testClientString(http.StatusOK, `{ "tracks": [] }`)
+	_, err := client.GetTracks(make([]ID, 51)...)
+	if err == nil || err.Error() != "spotify: GetTracks supports at most 50 IDs per call, got 51" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	tracks, err := client.GetTracks()
+	if err != nil || tracks == nil || len(tracks) != 0 {
+		t.Errorf("Expected an empty result, got %v, %v", tracks, err)
+	}
+	if getLastRequest(client) != nil {
+		t.Error("Expected no requests to be sent")
+	}
+}
+
+func TestSortSavedTracksByAddedAt(t *testing.T) {
+	tracks := []SavedTrack{
+		{AddedAt: "2016-03-01T10:00:00Z", FullTrack: FullTrack{SimpleTrack: SimpleTrack{ID: "b"}}},
+		{AddedAt: "2015-01-01T10:00:00Z", FullTrack: FullTrack{SimpleTrack: SimpleTrack{ID: "a"}}},
+		{AddedAt: "2017-08-21T18:30:00Z", FullTrack: FullTrack{SimpleTrack: SimpleTrack{ID: "c"}}},
+	}
+	if at := tracks[2].AddedAtTime(); !at.Equal(time.Date(2017, 8, 21, 18, 30, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected AddedAtTime: %v", at)
+	}
+	order := func() string {
+		var s string
+		for _, t := range tracks {
+			s += string(t.ID)
+		}
+		return s
+	}
+	SortSavedTracksByAddedAt(tracks, false)
+	if o := order(); o != "abc" {
+		t.Errorf("Expected abc, got %s", o)
+	}
+	SortSavedTracksByAddedAt(tracks, true)
+	if o := order(); o != "cba" {
+		t.Errorf("Expected cba, got %s", o)
+	}
+}
+
+func TestGetTracksForCurrentUser(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{ "id": "me", "country": "SE" }`},
+		cannedResponse{statusCode: http.StatusOK, body: `{ "tracks": [ { "id": "a" }, { "id": "b" } ] }`},
+	)
+	client.country = new(countryCache)
+	for i := 0; i < 2; i++ {
+		tracks, err := client.GetTracksForCurrentUser("a", "b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tracks) != 2 {
+			t.Fatalf("Expected 2 tracks, got %d", len(tracks))
+		}
+	}
+	if len(rt.requests) != 3 {
+		t.Fatalf("Expected the profile to be fetched once (3 requests), got %d requests", len(rt.requests))
+	}
+	if p := rt.requests[0].URL.Path; p != "/v1/me" {
+		t.Errorf("Expected the profile to be fetched first, got %s", p)
+	}
+	for _, r := range rt.requests[1:] {
+		if m := r.URL.Query().Get("market"); m != "SE" {
+			t.Errorf("Expected market SE, got %q", m)
+		}
+	}
+}
+
+func TestDownloadPreview(t *testing.T) {
+	rt := &sequenceRoundTripper{responses: []cannedResponse{{statusCode: http.StatusOK, body: "ID3 mp3 data"}}}
+	client := &Client{http: &http.Client{Transport: &oauth2.Transport{
+		Source: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "secret"}),
+		Base:   rt,
+	}}}
+	track := &FullTrack{SimpleTrack: SimpleTrack{PreviewURL: "https://p.scdn.co/mp3-preview/abc"}}
+	data, err := client.DownloadPreview(context.Background(), track)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "ID3 mp3 data" {
+		t.Errorf("Unexpected preview data: %q", data)
+	}
+	if auth := rt.requests[0].Header.Get("Authorization"); auth != "" {
+		t.Errorf("Expected no access token to be sent to the CDN, got %q", auth)
+	}
+
+	if _, err := client.DownloadPreview(context.Background(), &FullTrack{}); err != ErrNoPreview {
+		t.Errorf("Expected ErrNoPreview, got %v", err)
+	}
+}
+
+func TestTrackMarkets(t *testing.T) {
+	client := testClientFile(http.StatusOK, "test_data/find_track.txt")
+	markets, err := client.TrackMarkets("1zHlj4dQ8ZAtrayhuDDmkY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(markets) != 53 || markets[0] != "AD" {
+		t.Errorf("Expected 53 markets starting with AD, got %v", markets)
+	}
+	if q := getLastRequest(client).URL.RawQuery; q != "" {
+		t.Errorf("Expected no market to be requested, got %s", q)
+	}
+}
+
+func TestRelinkCache(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"tracks": [
+				{ "id": "played", "linked_from": { "id": "requested" } },
+				{ "id": "same" },
+				null
+			]
+		}`},
+	)
+	client.RelinkCache = NewRelinkCache()
+	if _, err := client.getTracks("GetTracks", "SE", []ID{"requested", "same", "missing"}); err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := client.RelinkCache.Lookup("SE", "requested"); !ok || id != "played" {
+		t.Errorf("Expected requested to be relinked to played, got %q %v", id, ok)
+	}
+	if _, ok := client.RelinkCache.Lookup("US", "requested"); ok {
+		t.Error("Mappings shouldn't be shared between markets")
+	}
+	id, err := client.RelinkedTrackID("same", "SE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "same" {
+		t.Errorf("Expected same, got %q", id)
+	}
+	if l := len(rt.requests); l != 1 {
+		t.Errorf("Expected cached lookups not to send requests, got %d requests", l)
+	}
+}
+
+func TestRelinkCacheZeroValue(t *testing.T) {
+	client := testClientString(http.StatusOK, `{ "id": "played", "linked_from": { "id": "requested" } }`)
+	client.RelinkCache = &RelinkCache{}
+	market := "SE"
+	if _, err := client.GetTrackOpt("requested", &Options{Country: &market}); err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := client.RelinkCache.Lookup("SE", "requested"); !ok || id != "played" {
+		t.Errorf("Expected requested to be relinked to played, got %q %v", id, ok)
+	}
+}
+
+func TestFilterByPopularity(t *testing.T) {
+	tracks := []FullTrack{
+		{SimpleTrack: SimpleTrack{ID: "a"}, Popularity: 80},
+		{SimpleTrack: SimpleTrack{ID: "b"}, Popularity: 20},
+		{SimpleTrack: SimpleTrack{ID: "c"}, Popularity: 50},
+	}
+	hits := FilterByPopularity(tracks, 50)
+	if len(hits) != 2 || hits[0].ID != "a" || hits[1].ID != "c" {
+		t.Errorf("Unexpected tracks %v", hits)
+	}
+	if len(FilterByPopularity(tracks, 101)) != 0 {
+		t.Error("Expected no tracks above the maximum popularity")
+	}
+}
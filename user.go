@@ -15,13 +15,14 @@
 package spotify
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // User contains the basic, publicly available information about a Spotify user.
@@ -67,6 +68,36 @@ type PrivateUser struct {
 	// This field is only available when the current user has granted
 	// access to the ScopeUserReadBirthdate scope.
 	Birthdate string `json:"birthdate"`
+	// The user's explicit content settings.  This field is only available
+	// when the current user has granted access to the ScopeUserReadPrivate scope.
+	ExplicitContent ExplicitContent `json:"explicit_content"`
+}
+
+// ExplicitContent contains a user's explicit content settings.
+type ExplicitContent struct {
+	// When true, the user's account is set to not play explicit content.
+	// Tracks requested with a market are then reported as unplayable,
+	// with the restriction reason "explicit".
+	FilterEnabled bool `json:"filter_enabled"`
+	// When true, the user can't change the setting themselves (for
+	// example, because it is controlled by a parent on a family plan).
+	FilterLocked bool `json:"filter_locked"`
+}
+
+// FilterExplicit removes explicit tracks from the slice if the user's
+// explicit content filter is enabled.  Otherwise, the tracks are returned
+// unchanged.  The tracks slice is modified in place.
+func (u *PrivateUser) FilterExplicit(tracks []FullTrack) []FullTrack {
+	if !u.ExplicitContent.FilterEnabled {
+		return tracks
+	}
+	result := tracks[:0]
+	for _, t := range tracks {
+		if !t.Explicit {
+			result = append(result, t)
+		}
+	}
+	return result
 }
 
 // GetUsersPublicProfile is a wrapper around DefaultClient.GetUsersPublicProfile.
@@ -77,16 +108,17 @@ func GetUsersPublicProfile(userID ID) (*User, error) {
 // GetUsersPublicProfile gets public profile information about a
 // Spotify User.  It does not require authentication.
 func (c *Client) GetUsersPublicProfile(userID ID) (*User, error) {
-	spotifyURL := baseAddress + "users/" + string(userID)
-	resp, err := c.http.Get(spotifyURL)
+	spotifyURL := c.baseURL() + "users/" + string(userID)
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var user User
-	err = json.NewDecoder(resp.Body).Decode(&user)
+	err = c.decode(resp.Body, &user)
 	if err != nil {
 		return nil, err
 	}
@@ -106,22 +138,56 @@ func (c *Client) GetUsersPublicProfile(userID ID) (*User, error) {
 // This email address is unverified - do not assume that Spotify has
 // checked that the email address actually belongs to the user.
 func (c *Client) CurrentUser() (*PrivateUser, error) {
-	resp, err := c.http.Get(baseAddress + "me")
+	resp, err := c.get(c.baseURL() + "me")
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var result PrivateUser
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	err = c.decode(resp.Body, &result)
 	if err != nil {
 		return nil, err
 	}
 	return &result, nil
 }
 
+// countryCache holds the current user's country once it's known.  Clients
+// refer to it by pointer, so that a Client can still be copied.
+type countryCache struct {
+	mu      sync.Mutex
+	country string
+}
+
+// currentUserCountry returns the country of the current user, fetching the
+// user's profile the first time it's called.  The lock isn't held while the
+// profile is fetched, so concurrent first calls may each fetch it.
+func (c *Client) currentUserCountry() (string, error) {
+	if c.country != nil {
+		c.country.mu.Lock()
+		country := c.country.country
+		c.country.mu.Unlock()
+		if country != "" {
+			return country, nil
+		}
+	}
+	user, err := c.CurrentUser()
+	if err != nil {
+		return "", err
+	}
+	if user.Country == "" {
+		return "", errors.New("spotify: the current user's country is unavailable (this requires the ScopeUserReadPrivate scope)")
+	}
+	if c.country != nil {
+		c.country.mu.Lock()
+		c.country.country = user.Country
+		c.country.mu.Unlock()
+	}
+	return user.Country, nil
+}
+
 // CurrentUsersTracks gets a list of songs saved in the current
 // Spotify user's "Your Music" library.
 func (c *Client) CurrentUsersTracks() (*SavedTrackPage, error) {
@@ -131,7 +197,7 @@ func (c *Client) CurrentUsersTracks() (*SavedTrackPage, error) {
 // CurrentUsersTracksOpt is like CurrentUsersTracks, but it accepts additional
 // options for sorting and filtering the results.
 func (c *Client) CurrentUsersTracksOpt(opt *Options) (*SavedTrackPage, error) {
-	spotifyURL := baseAddress + "me/tracks"
+	spotifyURL := c.baseURL() + "me/tracks"
 	if opt != nil {
 		v := url.Values{}
 		if opt.Country != nil {
@@ -147,22 +213,198 @@ func (c *Client) CurrentUsersTracksOpt(opt *Options) (*SavedTrackPage, error) {
 			spotifyURL += "?" + params
 		}
 	}
-	resp, err := c.http.Get(spotifyURL)
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
 	var result SavedTrackPage
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	err = c.decode(resp.Body, &result)
 	if err != nil {
 		return nil, err
 	}
 	return &result, nil
 }
 
+// SavedTrackStream delivers saved tracks as their pages are fetched.  See
+// StreamCurrentUsersTracks.
+type SavedTrackStream struct {
+	// Tracks receives the tracks in order.  It is closed once every
+	// page has been fetched, or when an error occurs.
+	Tracks <-chan SavedTrack
+
+	err error
+}
+
+// Err returns the error that stopped the stream, if any.  It must only
+// be called after Tracks has been closed.
+func (s *SavedTrackStream) Err() error {
+	return s.err
+}
+
+// StreamCurrentUsersTracks is like CurrentUsersTracks, but it follows the
+// paging links in the background and sends each track on the returned
+// stream as soon as its page arrives.  It behaves like
+// StreamCurrentUsersPlaylists: the consumer must drain Tracks or cancel
+// ctx, and should check Err once Tracks is closed.
+func (c *Client) StreamCurrentUsersTracks(ctx context.Context) *SavedTrackStream {
+	ch := make(chan SavedTrack)
+	stream := &SavedTrackStream{Tracks: ch}
+	go func() {
+		defer close(ch)
+		next := c.baseURL() + "me/tracks?limit=50"
+		for next != "" {
+			var page SavedTrackPage
+			if err := c.getPageContext(ctx, next, &page); err != nil {
+				stream.err = err
+				return
+			}
+			for _, t := range page.Tracks {
+				select {
+				case ch <- t:
+				case <-ctx.Done():
+					stream.err = ctx.Err()
+					return
+				}
+			}
+			next = page.Next
+		}
+	}()
+	return stream
+}
+
+// TrackExport describes a saved track in a form that doesn't depend on
+// Spotify, for backing up a library or moving it to another service.  The
+// ISRC is the most reliable way to find the same recording elsewhere; the
+// other fields can be used to match tracks that don't have one.
+type TrackExport struct {
+	// The International Standard Recording Code of the track, if known.
+	// It is set even if Spotify also lists other external IDs for the
+	// track, because ExternalID decoding prefers the ISRC.
+	ISRC    string   `json:"isrc,omitempty"`
+	Name    string   `json:"name"`
+	Artists []string `json:"artists"`
+	Album   string   `json:"album"`
+	// The time the track was saved, in the format of TimestampLayout.
+	AddedAt string `json:"added_at"`
+	// The Spotify URI of the track.
+	URI URI `json:"uri"`
+}
+
+// ExportSavedTracks fetches all of the tracks in the current user's "Your
+// Music" library and converts them to TrackExports, most recently saved
+// first.  This call requires the ScopeUserLibraryRead scope.
+func (c *Client) ExportSavedTracks(ctx context.Context) ([]TrackExport, error) {
+	var tracks []TrackExport
+	stream := c.StreamCurrentUsersTracks(ctx)
+	for t := range stream.Tracks {
+		export := TrackExport{
+			Name:    t.Name,
+			Album:   t.Album.Name,
+			AddedAt: t.AddedAt,
+			URI:     t.URI,
+		}
+		if t.ExternalIDs.Key == "isrc" {
+			export.ISRC = t.ExternalIDs.Value
+		}
+		for _, a := range t.Artists {
+			export.Artists = append(export.Artists, a.Name)
+		}
+		tracks = append(tracks, export)
+	}
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
+	return tracks, nil
+}
+
+// CurrentUsersTracksCount returns the number of tracks saved in the
+// current Spotify user's "Your Music" library.  It only requests a single
+// track, so it's a cheap way to size a progress bar before fetching the
+// whole library.  This call requires authorization.
+func (c *Client) CurrentUsersTracksCount() (int, error) {
+	return c.pageTotal(c.baseURL() + "me/tracks")
+}
+
+// CurrentUsersAlbumsCount returns the number of albums saved in the
+// current Spotify user's "Your Music" library.  This call requires
+// authorization.
+func (c *Client) CurrentUsersAlbumsCount() (int, error) {
+	return c.pageTotal(c.baseURL() + "me/albums")
+}
+
+// SavedTracksOptions contains options for CurrentUsersTracksAll.
+type SavedTracksOptions struct {
+	Options
+
+	// SortByAddedAt sorts the tracks by the time they were saved,
+	// oldest first.  By default, tracks are returned in the order the
+	// Web API returns them (most recently saved first).
+	SortByAddedAt bool
+	// DedupeISRC removes tracks whose ISRC (International Standard
+	// Recording Code) matches a track earlier in the result.  This
+	// collapses the same recording saved from different albums or
+	// releases.  Tracks without an ISRC are never removed.
+	DedupeISRC bool
+}
+
+// CurrentUsersTracksAll gets every track saved in the current Spotify
+// user's "Your Music" library, following the paging links until all
+// tracks have been fetched.  Limit, if set, controls the page size
+// (the default is 50, the maximum allowed by the Web API), and Offset
+// is ignored.  This call requires authorization.
+func (c *Client) CurrentUsersTracksAll(opt *SavedTracksOptions) ([]SavedTrack, error) {
+	first := Options{}
+	if opt != nil {
+		first.Country = opt.Country
+		first.Limit = opt.Limit
+	}
+	if first.Limit == nil {
+		limit := 50
+		first.Limit = &limit
+	}
+	page, err := c.CurrentUsersTracksOpt(&first)
+	if err != nil {
+		return nil, err
+	}
+	tracks := make([]SavedTrack, 0, page.Total)
+	for {
+		tracks = append(tracks, page.Tracks...)
+		if page.Next == "" {
+			break
+		}
+		next := page.Next
+		page = &SavedTrackPage{}
+		if err := c.getPage(next, page); err != nil {
+			return nil, err
+		}
+	}
+	if opt == nil {
+		return tracks, nil
+	}
+	if opt.SortByAddedAt {
+		SortSavedTracksByAddedAt(tracks, false)
+	}
+	if opt.DedupeISRC {
+		seen := make(map[string]bool)
+		deduped := tracks[:0]
+		for _, t := range tracks {
+			if t.ExternalIDs.Key == "isrc" && t.ExternalIDs.Value != "" {
+				if seen[t.ExternalIDs.Value] {
+					continue
+				}
+				seen[t.ExternalIDs.Value] = true
+			}
+			deduped = append(deduped, t)
+		}
+		tracks = deduped
+	}
+	return tracks, nil
+}
+
 // Follow adds the current user as a follower of one or more
 // artists or other spotify users, identified by their Spotify IDs.
 // This call requires authorization.
@@ -191,7 +433,8 @@ func (c *Client) Unfollow(ids ...ID) error {
 // "user" or "artist".
 //
 // The result is returned as a slice of bool values in the same order
-// in which the IDs were specified.
+// in which the IDs were specified.  It always contains one value for
+// each ID (see ErrUnexpectedResultCount).
 func (c *Client) CurrentUserFollows(t string, ids ...ID) ([]bool, error) {
 	if l := len(ids); l == 0 || l > 50 {
 		return nil, errors.New("spotify: UserFollows supports 1 to 50 IDs")
@@ -200,28 +443,108 @@ func (c *Client) CurrentUserFollows(t string, ids ...ID) ([]bool, error) {
 		return nil, errors.New("spotify: t must be 'artist' or 'user'")
 	}
 	spotifyURL := fmt.Sprintf("%sme/following/contains?type=%s&ids=%s",
-		baseAddress, t, strings.Join(toStringSlice(ids), ","))
-	resp, err := c.http.Get(spotifyURL)
+		c.baseURL(), t, strings.Join(toStringSlice(ids), ","))
+	resp, err := c.get(spotifyURL)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		return nil, decodeError(resp.Body)
+		return nil, decodeError(resp)
 	}
-	var result []bool
-	err = json.NewDecoder(resp.Body).Decode(&result)
-	if err != nil {
-		return nil, err
+	return c.decodeContains(resp.Body, len(ids))
+}
+
+// FollowCheck identifies an object for FollowStatus.
+type FollowCheck struct {
+	// Type is "artist", "user", or "playlist".
+	Type string
+	// ID is the Spotify ID of the artist, user, or playlist.
+	ID ID
+	// Owner is the user ID of the playlist's owner.  It is required
+	// for playlists and ignored otherwise.
+	Owner string
+}
+
+// FollowStatus checks whether the current user follows each of the given
+// artists, users, and playlists.  The checks are grouped into as few
+// requests as possible: one per 50 artists or users, plus one per
+// playlist (and one to look up the current user if there are any
+// playlists).  The result contains one value for each item, in the
+// same order as items.  If Spotify returns the wrong number of results for a
+// request, the statuses are still filled in and ErrUnexpectedResultCount is
+// returned along with them (see ErrUnexpectedResultCount).
+//
+// This call requires authorization, and that the application has the
+// ScopeUserFollowRead scope.  Privately followed playlists are only
+// reported if the application has the ScopePlaylistReadPrivate scope.
+func (c *Client) FollowStatus(items []FollowCheck) ([]bool, error) {
+	result := make([]bool, len(items))
+	// indexes into items, grouped by type
+	groups := make(map[string][]int)
+	for i, item := range items {
+		switch item.Type {
+		case "artist", "user":
+		case "playlist":
+			if item.Owner == "" {
+				return nil, errors.New("spotify: FollowStatus requires the owner of each playlist")
+			}
+		default:
+			return nil, fmt.Errorf("spotify: can't check follow status of type %q", item.Type)
+		}
+		groups[item.Type] = append(groups[item.Type], i)
+	}
+
+	// a count mismatch still leaves aligned results, so it's only
+	// reported once every status has been filled in
+	var countErr error
+	for _, t := range []string{"artist", "user"} {
+		indexes := groups[t]
+		for len(indexes) > 0 {
+			n := len(indexes)
+			if n > 50 {
+				n = 50
+			}
+			ids := make([]ID, n)
+			for k, i := range indexes[:n] {
+				ids[k] = items[i].ID
+			}
+			follows, err := c.CurrentUserFollows(t, ids...)
+			if err == ErrUnexpectedResultCount {
+				countErr = err
+			} else if err != nil {
+				return nil, err
+			}
+			for k, i := range indexes[:n] {
+				result[i] = follows[k]
+			}
+			indexes = indexes[n:]
+		}
+	}
+
+	if indexes := groups["playlist"]; len(indexes) > 0 {
+		me, err := c.CurrentUser()
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range indexes {
+			follows, err := c.UserFollowsPlaylist(items[i].Owner, items[i].ID, me.ID)
+			if err == ErrUnexpectedResultCount {
+				countErr = err
+			} else if err != nil {
+				return nil, err
+			}
+			result[i] = follows[0]
+		}
 	}
-	return result, nil
+	return result, countErr
 }
 
 func (c *Client) modifyFollowers(follow bool, ids ...ID) error {
 	if l := len(ids); l == 0 || l > 50 {
 		return errors.New("spotify: Follow/Unfollow supports 1 to 50 IDs")
 	}
-	spotifyURL := baseAddress + "me/following?" + strings.Join(toStringSlice(ids), ",")
+	spotifyURL := c.baseURL() + "me/following?" + strings.Join(toStringSlice(ids), ",")
 	method := "PUT"
 	if !follow {
 		method = "DELETE"
@@ -230,13 +553,13 @@ func (c *Client) modifyFollowers(follow bool, ids ...ID) error {
 	if err != nil {
 		return err
 	}
-	resp, err := c.http.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusNoContent {
-		return decodeError(resp.Body)
+		return decodeError(resp)
 	}
 	return nil
 }
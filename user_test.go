@@ -15,9 +15,12 @@
 package spotify
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 )
 
 const userResponse = `
@@ -93,6 +96,34 @@ func TestCurrentUser(t *testing.T) {
 	}
 }
 
+func TestExplicitContentFilter(t *testing.T) {
+	client := testClientString(http.StatusOK, `{
+		"id": "wizzler",
+		"explicit_content": { "filter_enabled": true, "filter_locked": true }
+	}`)
+	me, err := client.CurrentUser()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if !me.ExplicitContent.FilterEnabled || !me.ExplicitContent.FilterLocked {
+		t.Errorf("Expected a locked, enabled filter, got %+v\n", me.ExplicitContent)
+	}
+	tracks := make([]FullTrack, 3)
+	tracks[0].Name, tracks[1].Name, tracks[2].Name = "clean", "explicit", "also clean"
+	tracks[1].Explicit = true
+	tracks = me.FilterExplicit(tracks)
+	if len(tracks) != 2 || tracks[0].Name != "clean" || tracks[1].Name != "also clean" {
+		t.Errorf("Explicit track wasn't filtered: %v\n", tracks)
+	}
+
+	me.ExplicitContent.FilterEnabled = false
+	tracks[1].Explicit = true
+	if l := len(me.FilterExplicit(tracks)); l != 2 {
+		t.Errorf("Expected tracks to be unchanged with the filter disabled, got %d\n", l)
+	}
+}
+
 func TestFollowUsersMissingScope(t *testing.T) {
 	json := `{
 		"error": {
@@ -104,13 +135,19 @@ func TestFollowUsersMissingScope(t *testing.T) {
 	addDummyAuth(client)
 
 	err := client.Follow(ID("exampleuser01"))
-	if serr, ok := err.(Error); !ok {
+	var e Error
+	if !errors.As(err, &e) {
 		t.Error("Expected insufficient client scope error")
 	} else {
-		if serr.Status != http.StatusForbidden {
+		if e.Status != http.StatusForbidden {
 			t.Error("Expected HTTP 403")
 		}
 	}
+	if serr, ok := err.(InsufficientScopeError); !ok {
+		t.Error("Expected an InsufficientScopeError, got", err)
+	} else if len(serr.Required) != 1 || serr.Required[0] != ScopeUserFollowModify {
+		t.Error("Expected ScopeUserFollowModify to be required, got", serr.Required)
+	}
 }
 
 func TestFollowUsersInvalidToken(t *testing.T) {
@@ -175,3 +212,218 @@ func TestCurrentUsersTracks(t *testing.T) {
 		fmt.Printf("\n%#v\n", tracks.Tracks[0])
 	}
 }
+
+func TestStreamCurrentUsersTracksCancel(t *testing.T) {
+	client := testClientString(http.StatusOK, `{
+		"next": "https://api.spotify.com/v1/me/tracks?offset=2&limit=2",
+		"items": [ { "track": { "id": "a" } }, { "track": { "id": "b" } } ]
+	}`)
+	ctx, cancel := context.WithCancel(context.Background())
+	stream := client.StreamCurrentUsersTracks(ctx)
+	if track := <-stream.Tracks; track.ID != "a" {
+		t.Errorf("Expected track a, got %q", track.ID)
+	}
+	cancel()
+	for range stream.Tracks {
+	}
+	if err := stream.Err(); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
+
+func TestExportSavedTracks(t *testing.T) {
+	client, _ := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"next": "https://api.spotify.com/v1/me/tracks?offset=1&limit=1",
+			"items": [ {
+				"added_at": "2016-03-01T10:00:00Z",
+				"track": {
+					"name": "Song",
+					"uri": "spotify:track:a",
+					"artists": [ { "name": "One" }, { "name": "Two" } ],
+					"album": { "name": "Record" },
+					"external_ids": { "ean": "5099749994324", "isrc": "USRC17607839", "upc": "00602517512078" }
+				}
+			} ]
+		}`},
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"items": [ { "added_at": "2015-01-01T10:00:00Z", "track": { "name": "Other", "external_ids": { "ean": "5099749994324" } } } ]
+		}`},
+	)
+	tracks, err := client.ExportSavedTracks(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 2 {
+		t.Fatalf("Expected 2 tracks, got %d", len(tracks))
+	}
+	got := tracks[0]
+	if got.ISRC != "USRC17607839" || got.Name != "Song" || got.Album != "Record" ||
+		got.AddedAt != "2016-03-01T10:00:00Z" || len(got.Artists) != 2 || got.Artists[1] != "Two" {
+		t.Errorf("Unexpected export %+v", got)
+	}
+	if tracks[1].ISRC != "" {
+		t.Errorf("Expected no ISRC, got %q", tracks[1].ISRC)
+	}
+}
+
+func TestCurrentUsersTracksAll(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"total": 3,
+			"next": "https://api.spotify.com/v1/me/tracks?offset=2&limit=2",
+			"items": [
+				{ "added_at": "2016-03-01T10:00:00Z", "track": { "id": "c", "external_ids": { "isrc": "ISRC1" } } },
+				{ "added_at": "2015-01-01T10:00:00Z", "track": { "id": "a", "external_ids": { "isrc": "ISRC1" } } }
+			]
+		}`},
+		cannedResponse{statusCode: http.StatusOK, body: `{
+			"total": 3,
+			"items": [
+				{ "added_at": "2015-06-01T10:00:00Z", "track": { "id": "b" } }
+			]
+		}`},
+	)
+	limit := 2
+	tracks, err := client.CurrentUsersTracksAll(&SavedTracksOptions{
+		Options:       Options{Limit: &limit},
+		SortByAddedAt: true,
+		DedupeISRC:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rt.requests) != 2 {
+		t.Fatalf("Expected 2 requests, got %d", len(rt.requests))
+	}
+	if q := rt.requests[0].URL.Query().Get("limit"); q != "2" {
+		t.Errorf("Expected limit=2, got %q", q)
+	}
+	var ids []ID
+	for _, t := range tracks {
+		ids = append(ids, t.ID)
+	}
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "b" {
+		t.Errorf("Expected [a b], got %v", ids)
+	}
+	if tracks[0].ExternalIDs.Key != "isrc" || tracks[0].ExternalIDs.Value != "ISRC1" {
+		t.Errorf("External ID not decoded: %+v", tracks[0].ExternalIDs)
+	}
+}
+
+func TestCurrentUsersTracksCount(t *testing.T) {
+	client, rt := testClientSequence(cannedResponse{
+		statusCode: http.StatusOK,
+		body:       `{ "href": "x", "limit": 1, "offset": 0, "total": 1234, "items": [ { "added_at": "2016-03-01T10:00:00Z", "track": {} } ] }`,
+	})
+	client.StrictDecoding = true
+	n, err := client.CurrentUsersTracksCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1234 {
+		t.Errorf("Expected 1234, got %d", n)
+	}
+	n, err = client.CurrentUsersAlbumsCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1234 {
+		t.Errorf("Expected 1234, got %d", n)
+	}
+	for i, want := range []string{"/v1/me/tracks", "/v1/me/albums"} {
+		u := rt.requests[i].URL
+		if u.Path != want || u.Query().Get("limit") != "1" {
+			t.Errorf("Expected request to %s?limit=1, got %s", want, u)
+		}
+	}
+}
+
+func TestFollowStatus(t *testing.T) {
+	client, rt := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `[false, true]`},
+		cannedResponse{statusCode: http.StatusOK, body: `[true]`},
+		cannedResponse{statusCode: http.StatusOK, body: `{ "id": "me" }`},
+		cannedResponse{statusCode: http.StatusOK, body: `[true]`},
+	)
+	follows, err := client.FollowStatus([]FollowCheck{
+		{Type: "playlist", ID: "p1", Owner: "bob"},
+		{Type: "artist", ID: "a1"},
+		{Type: "user", ID: "u1"},
+		{Type: "artist", ID: "a2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []bool{true, false, true, true}
+	for i := range expected {
+		if follows[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, follows)
+			break
+		}
+	}
+	paths := []string{
+		"/v1/me/following/contains?type=artist&ids=a1,a2",
+		"/v1/me/following/contains?type=user&ids=u1",
+		"/v1/me",
+		"/v1/users/bob/playlists/p1/followers/contains?ids=me",
+	}
+	if len(rt.requests) != len(paths) {
+		t.Fatalf("Expected %d requests, got %d", len(paths), len(rt.requests))
+	}
+	for i, p := range paths {
+		if got := rt.requests[i].URL.RequestURI(); got != p {
+			t.Errorf("Request %d: expected %s, got %s", i, p, got)
+		}
+	}
+
+	if _, err := client.FollowStatus([]FollowCheck{{Type: "playlist", ID: "p1"}}); err == nil {
+		t.Error("Expected an error for a playlist without an owner")
+	}
+}
+
+func TestFollowStatusUnexpectedResultCount(t *testing.T) {
+	client, _ := testClientSequence(
+		cannedResponse{statusCode: http.StatusOK, body: `[true]`},
+		cannedResponse{statusCode: http.StatusOK, body: `{ "id": "me" }`},
+		cannedResponse{statusCode: http.StatusOK, body: `[true]`},
+	)
+	follows, err := client.FollowStatus([]FollowCheck{
+		{Type: "artist", ID: "a1"},
+		{Type: "artist", ID: "a2"},
+		{Type: "playlist", ID: "p1", Owner: "bob"},
+	})
+	if err != ErrUnexpectedResultCount {
+		t.Fatal("Expected ErrUnexpectedResultCount, got", err)
+	}
+	expected := []bool{true, false, true}
+	for i := range expected {
+		if follows[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, follows)
+			break
+		}
+	}
+}
+
+func TestGetUsersPublicProfileReleasesLimiter(t *testing.T) {
+	client := &Client{http: &http.Client{Transport: &concurrencyRoundTripper{}}}
+	client.SetMaxConcurrency(1)
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 2; i++ {
+			if _, err := client.GetUsersPublicProfile("abc"); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The second request blocked: the first didn't release its slot")
+	}
+}